@@ -0,0 +1,74 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The patterns below follow the image reference grammar of
+// github.com/distribution/distribution/reference.
+var (
+	imageNamePattern = regexp.MustCompile(
+		`^(?:(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9])(?:\.(?:[a-zA-Z0-9]|[a-zA-Z0-9][a-zA-Z0-9-]*[a-zA-Z0-9]))*(?::[0-9]+)?/)?` +
+			`[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*(?:/[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*)*$`)
+	imageTagPattern    = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	imageDigestPattern = regexp.MustCompile(`^[a-z0-9]+(?:[.+_-][a-z0-9]+)*:[a-zA-Z0-9=_-]{32,}$`)
+	sha256HexPattern   = regexp.MustCompile(`^[a-f0-9]{64}$`)
+)
+
+// validateImageReference checks that image is a well-formed reference of the
+// form name[:tag][@digest].
+func validateImageReference(image string) error {
+	name, digest := image, ""
+	if i := strings.Index(image, "@"); i >= 0 {
+		name, digest = image[:i], image[i+1:]
+		if err := validateDigest(digest); err != nil {
+			return err
+		}
+	}
+
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		tag := name[i+1:]
+		name = name[:i]
+		if !imageTagPattern.MatchString(tag) {
+			return fmt.Errorf("invalid tag %q", tag)
+		}
+	}
+	if len(name) > 255 {
+		return errors.New("repository name must not be longer than 255 characters")
+	}
+	if !imageNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid repository name %q", name)
+	}
+	return nil
+}
+
+// validateDigest checks a content digest such as sha256:<64 hex digits>.
+func validateDigest(digest string) error {
+	if !imageDigestPattern.MatchString(digest) {
+		return fmt.Errorf("invalid digest %q", digest)
+	}
+	parts := strings.SplitN(digest, ":", 2)
+	if parts[0] == "sha256" && !sha256HexPattern.MatchString(parts[1]) {
+		return fmt.Errorf("invalid sha256 digest %q: expected 64 lowercase hex digits", digest)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// HttpdConfDir is the directory httpd reads httpd.conf from in the
+	// webserver image.
+	HttpdConfDir = "/opt/rh/httpd24/root/etc/httpd/conf"
+
+	// HttpdTLSDir is the directory the TLS Secret is mounted at.
+	HttpdTLSDir = "/opt/rh/httpd24/root/etc/httpd/tls"
+
+	// HttpdDataDir is the httpd document root, where a StatefulSet's
+	// per-pod storage is mounted.
+	HttpdDataDir = "/opt/rh/httpd24/root/var/www/html"
+
+	// DefaultServiceAccountTokenPath is where the projected ServiceAccount
+	// token is written when ServiceAccountToken does not set a path.
+	DefaultServiceAccountTokenPath = "/var/run/secrets/tokens/token"
+
+	// serviceAccountDir is where Kubernetes mounts the pod's own
+	// ServiceAccount credentials.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// validateTokenMount checks that the directory the ServiceAccountToken is
+// mounted at neither is, contains nor lies inside another mount of the
+// webserver container: the pod's ServiceAccount credentials, the httpd
+// config, TLS and data directories, or a mount podSpecPatch adds.
+func (r *Webserver) validateTokenMount(path *field.Path) field.ErrorList {
+	tokenPath := r.Spec.ServiceAccountToken.Path
+	if tokenPath == "" {
+		tokenPath = DefaultServiceAccountTokenPath
+	}
+	dir := filepath.Dir(tokenPath)
+
+	reserved := []string{serviceAccountDir, HttpdConfDir, HttpdTLSDir, HttpdDataDir}
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: WebserverContainerName}}}
+	if err := ApplyPodSpecPatch(spec, r.Spec.PodSpecPatch); err == nil {
+		for _, container := range spec.Containers {
+			if container.Name != WebserverContainerName {
+				continue
+			}
+			for _, mount := range container.VolumeMounts {
+				reserved = append(reserved, filepath.Clean(mount.MountPath))
+			}
+		}
+	}
+	for _, other := range reserved {
+		if mountDirsOverlap(dir, other) {
+			return field.ErrorList{field.Invalid(path.Child("path"), tokenPath,
+				fmt.Sprintf("its directory %s would be mounted over or inside %s, which the webserver container already mounts", dir, other))}
+		}
+	}
+	return nil
+}
+
+// mountDirsOverlap reports whether mounting a and b would shadow one of
+// them: they are the same directory, or one lies inside the other.
+func mountDirsOverlap(a, b string) bool {
+	return a == b || strings.HasPrefix(a, b+"/") || strings.HasPrefix(b, a+"/")
+}
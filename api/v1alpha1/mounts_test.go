@@ -0,0 +1,57 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateSpecChecksTokenMount(t *testing.T) {
+	patch := `{"containers":[{"name":"webserver","volumeMounts":[{"name":"cache","mountPath":"/var/cache/tokens"}]}]}`
+	for _, tc := range []struct {
+		name, path string
+		wantErr    bool
+	}{
+		{name: "default path"},
+		{name: "own directory", path: "/var/run/tokens/token"},
+		{name: "ServiceAccount credentials", path: "/var/run/secrets/kubernetes.io/serviceaccount/token", wantErr: true},
+		{name: "parent of the ServiceAccount credentials", path: "/var/run/secrets/token", wantErr: true},
+		{name: "httpd config", path: HttpdConfDir + "/token", wantErr: true},
+		{name: "inside the document root", path: HttpdDataDir + "/private/token", wantErr: true},
+		{name: "podSpecPatch mount", path: "/var/cache/tokens/token", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			instance := &Webserver{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec: WebserverSpec{
+					ServiceAccountToken: &ProjectedServiceAccountToken{Audience: "vault", Path: tc.path},
+					PodSpecPatch:        &runtime.RawExtension{Raw: []byte(patch)},
+				},
+			}
+			errs := instance.ValidateSpec()
+			if tc.wantErr && len(errs) == 0 {
+				t.Fatal("expected the token path to be rejected")
+			}
+			if !tc.wantErr && len(errs) > 0 {
+				t.Fatalf("unexpected errors: %v", errs.ToAggregate())
+			}
+		})
+	}
+}
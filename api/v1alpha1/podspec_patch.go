@@ -0,0 +1,57 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+)
+
+// WebserverContainerName names the httpd container in a Webserver's pods.
+const WebserverContainerName = "webserver"
+
+// ApplyPodSpecPatch applies patch, a strategic merge patch, to spec. It
+// fails if the patch does not parse or if the patched spec no longer has the
+// webserver container.
+func ApplyPodSpecPatch(spec *corev1.PodSpec, patch *runtime.RawExtension) error {
+	if patch == nil || len(patch.Raw) == 0 {
+		return nil
+	}
+	original, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	patched, err := strategicpatch.StrategicMergePatch(original, patch.Raw, corev1.PodSpec{})
+	if err != nil {
+		return fmt.Errorf("applying podSpecPatch: %w", err)
+	}
+	result := corev1.PodSpec{}
+	if err := json.Unmarshal(patched, &result); err != nil {
+		return fmt.Errorf("applying podSpecPatch: %w", err)
+	}
+	for _, container := range result.Containers {
+		if container.Name == WebserverContainerName {
+			*spec = result
+			return nil
+		}
+	}
+	return fmt.Errorf("podSpecPatch must not remove or rename the %s container", WebserverContainerName)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+const (
+	// ServingPort is the port httpd listens on in the webserver container.
+	// Services target it by number.
+	ServingPort = 8080
+
+	// ServingPortName names the serving port on both the container and the
+	// Services, so a Route can target it by name.
+	ServingPortName = "http"
+
+	// HealthPortName names the container port the probes target when the
+	// Webserver sets a HealthPort.
+	HealthPortName = "health"
+)
+
+// ContainerPorts returns the ports the operator declares on the webserver
+// container: the serving port, again for each other protocol a Service
+// uses, and, when set, the health port.
+func (r *Webserver) ContainerPorts() []corev1.ContainerPort {
+	ports := []corev1.ContainerPort{
+		{
+			Name:          ServingPortName,
+			ContainerPort: ServingPort,
+		},
+	}
+	declared := map[corev1.Protocol]bool{corev1.ProtocolTCP: true}
+	for _, service := range r.Spec.Services {
+		protocol := protocolOrTCP(service.Protocol)
+		if declared[protocol] {
+			continue
+		}
+		declared[protocol] = true
+		ports = append(ports, corev1.ContainerPort{
+			Name:          ServingPortName + "-" + strings.ToLower(string(protocol)),
+			ContainerPort: ServingPort,
+			Protocol:      protocol,
+		})
+	}
+	if r.Spec.HealthPort != 0 {
+		ports = append(ports, corev1.ContainerPort{
+			Name:          HealthPortName,
+			ContainerPort: r.Spec.HealthPort,
+		})
+	}
+	return ports
+}
+
+// validatePorts checks that the webserver container, with podSpecPatch
+// applied, still declares the serving port for the protocol of every
+// Service, naming the first Service port left without one. The Route and
+// HTTPRoute target the serving port of a TCP Service, which the Service
+// checks cover.
+func (r *Webserver) validatePorts() field.ErrorList {
+	spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: WebserverContainerName, Ports: r.ContainerPorts()}}}
+	if err := ApplyPodSpecPatch(spec, r.Spec.PodSpecPatch); err != nil {
+		// Reported with the other podSpecPatch problems.
+		return nil
+	}
+	var ports []corev1.ContainerPort
+	for _, container := range spec.Containers {
+		if container.Name == WebserverContainerName {
+			ports = container.Ports
+		}
+	}
+	declared := func(protocol corev1.Protocol) bool {
+		for _, port := range ports {
+			if port.ContainerPort == ServingPort && protocolOrTCP(port.Protocol) == protocol {
+				return true
+			}
+		}
+		return false
+	}
+
+	services := r.Spec.Services
+	if len(services) == 0 {
+		services = []ServiceSpec{{Name: r.Name}}
+		if r.Spec.ServiceName != "" {
+			services[0].Name = r.Spec.ServiceName
+		}
+	}
+	for _, service := range services {
+		protocol := protocolOrTCP(service.Protocol)
+		if !declared(protocol) {
+			return field.ErrorList{field.Invalid(field.NewPath("spec", "podSpecPatch"), string(r.Spec.PodSpecPatch.Raw),
+				fmt.Sprintf("Service %q port %q targets %s container port %d, which the %s container no longer declares",
+					service.Name, ServingPortName, protocol, ServingPort, WebserverContainerName))}
+		}
+	}
+	return nil
+}
+
+// protocolOrTCP returns protocol, or TCP, which the API server defaults it
+// to, when it is unset.
+func protocolOrTCP(protocol corev1.Protocol) corev1.Protocol {
+	if protocol == "" {
+		return corev1.ProtocolTCP
+	}
+	return protocol
+}
@@ -0,0 +1,69 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestValidateSpecChecksServicePorts(t *testing.T) {
+	for _, tc := range []struct {
+		name, patch string
+		protocol    corev1.Protocol
+		wantErr     string
+	}{
+		{
+			name:  "patch adds a port",
+			patch: `{"containers":[{"name":"webserver","ports":[{"name":"metrics","containerPort":9090}]}]}`,
+		},
+		{
+			name:    "patch replaces the serving port",
+			patch:   `{"containers":[{"name":"webserver","ports":[{"$patch":"replace"},{"name":"http","containerPort":9090}]}]}`,
+			wantErr: `Service "web" port "http" targets TCP container port 8080`,
+		},
+		{
+			name:     "patch drops the UDP serving port",
+			patch:    `{"containers":[{"name":"webserver","ports":[{"$patch":"replace"},{"name":"http","containerPort":8080}]}]}`,
+			protocol: corev1.ProtocolUDP,
+			wantErr:  `Service "web" port "http" targets UDP container port 8080`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			createRoute := false
+			instance := &Webserver{
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+				Spec: WebserverSpec{
+					CreateRoute:  &createRoute,
+					Services:     []ServiceSpec{{Name: "web", Protocol: tc.protocol}},
+					PodSpecPatch: &runtime.RawExtension{Raw: []byte(tc.patch)},
+				},
+			}
+			err := instance.ValidateSpec().ToAggregate()
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("got error %v, want one containing %q", err, tc.wantErr)
+			}
+		})
+	}
+}
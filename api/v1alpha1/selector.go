@@ -0,0 +1,35 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+// PodSelector returns the labels that select the Webserver's pods: Selector
+// when set, and otherwise the standard app label plus any SelectorLabels,
+// which cannot override it.
+func (r *Webserver) PodSelector() map[string]string {
+	labels := map[string]string{}
+	if r.Spec.Selector != nil {
+		for k, v := range r.Spec.Selector {
+			labels[k] = v
+		}
+		return labels
+	}
+	for k, v := range r.Spec.SelectorLabels {
+		labels[k] = v
+	}
+	labels["app"] = r.Name
+	return labels
+}
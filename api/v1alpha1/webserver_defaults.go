@@ -0,0 +1,109 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+const (
+	// defaultingWebhookPath serves the mutating webhook that fills in
+	// namespace-dependent defaults.
+	defaultingWebhookPath = "/mutate-servers-redhat-com-v1alpha1-webserver"
+
+	// podSecurityEnforceLabel is the namespace label selecting the Pod
+	// Security Standard enforced on the namespace's pods.
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+)
+
+//+kubebuilder:webhook:path=/mutate-servers-redhat-com-v1alpha1-webserver,mutating=true,failurePolicy=fail,sideEffects=None,groups=servers.redhat.com,resources=webservers,verbs=create;update,versions=v1alpha1,name=mwebserver.kb.io,admissionReviewVersions={v1,v1beta1}
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get
+
+// webserverDefaulter defaults the webserver container's security context
+// from the Pod Security level enforced on the namespace the pods run in:
+// Spec.TargetNamespace when set, and otherwise the Webserver's own. It is a
+// plain admission handler rather than a webhook.Defaulter because it reads
+// the namespace.
+type webserverDefaulter struct {
+	reader  client.Reader
+	decoder *admission.Decoder
+}
+
+var _ admission.Handler = &webserverDefaulter{}
+
+// Handle implements admission.Handler.
+func (d *webserverDefaulter) Handle(ctx context.Context, req admission.Request) admission.Response {
+	r := &Webserver{}
+	if err := d.decoder.Decode(req, r); err != nil {
+		return admission.Errored(http.StatusBadRequest, err)
+	}
+	if r.Spec.SecurityContext != nil {
+		return admission.Allowed("securityContext is set")
+	}
+
+	name := req.Namespace
+	if r.Spec.TargetNamespace != "" {
+		name = r.Spec.TargetNamespace
+	}
+	namespace := &corev1.Namespace{}
+	if err := d.reader.Get(ctx, types.NamespacedName{Name: name}, namespace); apierrors.IsNotFound(err) {
+		// Only a target namespace can be missing. Creating the Webserver
+		// first would leave its pods without the defaults once the
+		// namespace exists.
+		return admission.Denied(fmt.Sprintf("target namespace %q does not exist", name))
+	} else if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	level := namespace.Labels[podSecurityEnforceLabel]
+	if level != "restricted" {
+		return admission.Allowed("namespace does not enforce the restricted Pod Security Standard")
+	}
+
+	webserverlog.Info("default securityContext", "name", r.Name, "namespace", name, "level", level)
+	r.Spec.SecurityContext = restrictedSecurityContext()
+	marshaled, err := json.Marshal(r)
+	if err != nil {
+		return admission.Errored(http.StatusInternalServerError, err)
+	}
+	return admission.PatchResponseFromRaw(req.Object.Raw, marshaled)
+}
+
+// restrictedSecurityContext returns a container security context that
+// satisfies the restricted Pod Security Standard.
+func restrictedSecurityContext() *corev1.SecurityContext {
+	allowPrivilegeEscalation := false
+	runAsNonRoot := true
+	return &corev1.SecurityContext{
+		AllowPrivilegeEscalation: &allowPrivilegeEscalation,
+		RunAsNonRoot:             &runAsNonRoot,
+		Capabilities: &corev1.Capabilities{
+			Drop: []corev1.Capability{"ALL"},
+		},
+		SeccompProfile: &corev1.SeccompProfile{
+			Type: corev1.SeccompProfileTypeRuntimeDefault,
+		},
+	}
+}
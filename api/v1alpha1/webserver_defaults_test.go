@@ -0,0 +1,103 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	admissionv1 "k8s.io/api/admission/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+func TestDefaulterUsesPodNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := clientgoscheme.AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddToScheme(scheme); err != nil {
+		t.Fatal(err)
+	}
+	decoder, err := admission.NewDecoder(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restricted := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "restricted",
+		Labels: map[string]string{podSecurityEnforceLabel: "restricted"},
+	}}
+	baseline := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "baseline",
+		Labels: map[string]string{podSecurityEnforceLabel: "baseline"},
+	}}
+	d := &webserverDefaulter{
+		reader:  fake.NewClientBuilder().WithScheme(scheme).WithObjects(restricted, baseline).Build(),
+		decoder: decoder,
+	}
+
+	for _, tc := range []struct {
+		name, namespace, targetNamespace string
+		hardened, denied                 bool
+	}{
+		{name: "own namespace restricted", namespace: "restricted", hardened: true},
+		{name: "own namespace baseline", namespace: "baseline"},
+		{name: "target namespace restricted", namespace: "baseline", targetNamespace: "restricted", hardened: true},
+		{name: "target namespace baseline", namespace: "restricted", targetNamespace: "baseline"},
+		{name: "target namespace missing", namespace: "baseline", targetNamespace: "missing", denied: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			webserver := &Webserver{
+				TypeMeta:   metav1.TypeMeta{APIVersion: GroupVersion.String(), Kind: "Webserver"},
+				ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: tc.namespace},
+				Spec:       WebserverSpec{TargetNamespace: tc.targetNamespace},
+			}
+			raw, err := json.Marshal(webserver)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp := d.Handle(context.Background(), admission.Request{AdmissionRequest: admissionv1.AdmissionRequest{
+				Operation: admissionv1.Create,
+				Namespace: tc.namespace,
+				Object:    runtime.RawExtension{Raw: raw},
+			}})
+			if tc.denied {
+				if resp.Allowed || resp.Result.Code >= 500 {
+					t.Fatalf("want a denial, got allowed=%v result %v", resp.Allowed, resp.Result)
+				}
+				return
+			}
+			if !resp.Allowed {
+				t.Fatalf("request denied: %v", resp.Result)
+			}
+			patched := false
+			for _, patch := range resp.Patches {
+				if patch.Path == "/spec/securityContext" {
+					patched = true
+				}
+			}
+			if patched != tc.hardened {
+				t.Errorf("securityContext defaulted = %v, want %v (patches %v)", patched, tc.hardened, resp.Patches)
+			}
+		})
+	}
+}
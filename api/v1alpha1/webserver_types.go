@@ -17,7 +17,10 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // EDIT THIS FILE!  THIS IS SCAFFOLDING FOR YOU TO OWN!
@@ -28,17 +31,1110 @@ type WebserverSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
-	Count int32 `json:"count,omitempty"`
+	// Count is the number of pods to run. It defaults to 1 when unset; set
+	// it to 0 to scale the Webserver down. It is ignored when WorkloadType
+	// is DaemonSet.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	Count *int32 `json:"count,omitempty"`
+
+	// WorkloadType selects whether the pods are run by a Deployment, by a
+	// DaemonSet, which runs one pod on every schedulable node, or by a
+	// StatefulSet, which gives each pod a stable name and DNS entry through
+	// a headless Service and rolls them out in order. Switching it deletes
+	// the workload of the other types once the new one is created, so the
+	// pods are replaced. Count and ScaleSchedule do not apply to
+	// DaemonSets; SelfHeal, PauseRollout, ZeroDowntime and
+	// RecreateOnSelectorChange only apply to Deployments.
+	// +kubebuilder:default=Deployment
+	// +optional
+	WorkloadType WorkloadType `json:"workloadType,omitempty"`
+
+	// ScaleSchedule overrides Count on a schedule, for example to scale
+	// down at night. Count applies until the first rule fires.
+	// +optional
+	ScaleSchedule *ScaleSchedule `json:"scaleSchedule,omitempty"`
+
+	// Image is the httpd container image, referenced by tag or by digest
+	// (name@sha256:...). It defaults to the RHSCL httpd 2.4 image.
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// SelfHeal selects how the operator recovers a rollout that has exceeded
+	// its progress deadline. It is ignored unless the operator is started
+	// with --enable-self-heal.
+	// +optional
+	SelfHeal SelfHealPolicy `json:"selfHeal,omitempty"`
+
+	// ProgressDeadlineSeconds is how long a Deployment rollout may go
+	// without progress before the Deployment controller marks it failed,
+	// which triggers SelfHeal. It defaults to 600, and may only be set
+	// with the Deployment workload type.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	ProgressDeadlineSeconds *int32 `json:"progressDeadlineSeconds,omitempty"`
+
+	// RuntimeClassName selects the RuntimeClass, such as gVisor or Kata, that
+	// runs the Webserver's pods. The named RuntimeClass must already exist in
+	// the cluster; the operator does not check for it.
+	// +optional
+	RuntimeClassName *string `json:"runtimeClassName,omitempty"`
+
+	// Overhead is the resources the pod's sandbox consumes on top of its
+	// containers, used by the scheduler and for quota. It is usually filled
+	// in from the RuntimeClass; when the RuntimeClass defines an overhead,
+	// this must match it or the pods are rejected.
+	// +optional
+	Overhead corev1.ResourceList `json:"overhead,omitempty"`
+
+	// ShareProcessNamespace puts the pod's containers in one process
+	// namespace, so a debugging sidecar or ephemeral container can see and
+	// attach to httpd's processes. httpd then no longer runs as PID 1.
+	// Changes to it roll the pods.
+	// +optional
+	ShareProcessNamespace *bool `json:"shareProcessNamespace,omitempty"`
+
+	// ReadinessGates are extra pod conditions, such as one set by a
+	// service mesh, that must be True before a pod is ready and receives
+	// traffic. Changes to them roll the pods.
+	// +optional
+	ReadinessGates []corev1.PodReadinessGate `json:"readinessGates,omitempty"`
+
+	// SpreadAcrossNodes asks the scheduler to place the Webserver's pods on
+	// different nodes where it can, through a preferred pod anti-affinity
+	// on the selector labels. It is added to any affinity set by
+	// PodSpecPatch or TemplateRef. Changes to it roll the pods.
+	// +optional
+	SpreadAcrossNodes bool `json:"spreadAcrossNodes,omitempty"`
+
+	// TemporaryTolerations are pod tolerations that apply until they
+	// expire, such as while nodes are drained for maintenance. They are
+	// added to any tolerations from PodSpecPatch or TemplateRef. Adding and
+	// removing them rolls the pods, as with any pod template change.
+	// +optional
+	TemporaryTolerations []TemporaryToleration `json:"temporaryTolerations,omitempty"`
+
+	// TargetNamespace is the namespace the Deployment, Service and Route are
+	// created in. It defaults to the Webserver's own namespace. Resources in
+	// another namespace cannot be owner-referenced, so they are tracked by
+	// label and removed by the operator when the Webserver is deleted.
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// DeploymentLabels are added to the Deployment's own metadata, for
+	// example for cost reporting. They are not propagated to the pods.
+	// +optional
+	DeploymentLabels map[string]string `json:"deploymentLabels,omitempty"`
+
+	// SelectorLabels are added to the standard app label to select the
+	// Webserver's pods, for example a version label. A Deployment's selector
+	// cannot change, so they only take effect when the Deployment is
+	// created, and the selector it was created with is recorded in
+	// Status.SelectorLabels. Once it is, the webhook rejects changes unless
+	// RecreateOnSelectorChange is set; without the webhook they are reported
+	// through the SelectorUpToDate condition and the original selector is
+	// kept.
+	// +optional
+	SelectorLabels map[string]string `json:"selectorLabels,omitempty"`
+
+	// Selector replaces the standard app label and SelectorLabels as the
+	// labels selecting the Webserver's pods, for moving to a new set of
+	// selector labels. Like SelectorLabels it only takes effect when the
+	// Deployment is created, unless RecreateOnSelectorChange is set.
+	// +optional
+	Selector map[string]string `json:"selector,omitempty"`
+
+	// PodLabels are added to the pods in addition to the selector labels.
+	// Adding the labels of a new Selector here first lets the running pods
+	// carry them before the selector changes.
+	// +optional
+	PodLabels map[string]string `json:"podLabels,omitempty"`
+
+	// RecreateOnSelectorChange lets the operator replace the Deployment
+	// when its selector no longer matches the one the Webserver asks for.
+	// The Deployment is only replaced once its pods carry the new selector
+	// labels, and its pods are orphaned rather than deleted, so the new
+	// Deployment adopts them without downtime.
+	// +optional
+	RecreateOnSelectorChange bool `json:"recreateOnSelectorChange,omitempty"`
+
+	// PodAnnotations are added to the pod template only, for example to
+	// request sidecar injection from a service mesh. Changing them rolls the
+	// pods.
+	// +optional
+	PodAnnotations map[string]string `json:"podAnnotations,omitempty"`
+
+	// Sidecars are added to the pods after the webserver container. They
+	// take the place of any sidecar of the same name injected for the
+	// namespace.
+	// +optional
+	Sidecars []corev1.Container `json:"sidecars,omitempty"`
+
+	// ExtraConfigMaps are ConfigMaps the operator creates in the target
+	// namespace and deletes with the Webserver, for example to mount
+	// through PodSpecPatch. ConfigMaps removed from the list are deleted.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ExtraConfigMaps []InlineConfigMap `json:"extraConfigMaps,omitempty"`
+
+	// Monitoring creates a PrometheusRule of default alerts for the
+	// Webserver, based on the operator's metrics, when the PrometheusRule
+	// CRD is installed. Removing it deletes the PrometheusRule.
+	// +optional
+	Monitoring *WebserverMonitoring `json:"monitoring,omitempty"`
+
+	// ReachabilityCheck enables an HTTP check the operator runs against the
+	// Webserver's Service, reported through the Reachable condition. The
+	// check is skipped when unset.
+	// +optional
+	ReachabilityCheck *ReachabilityCheck `json:"reachabilityCheck,omitempty"`
+
+	// AppProtocol is the application protocol of the Services' http port,
+	// used by service meshes to classify traffic, for the Services in
+	// Services that do not set their own.
+	// +kubebuilder:default=http
+	// +optional
+	AppProtocol string `json:"appProtocol,omitempty"`
+
+	// RouteTargetsPortName makes the Route target the Service's port by its
+	// name, "http", instead of by number.
+	// +optional
+	RouteTargetsPortName bool `json:"routeTargetsPortName,omitempty"`
+
+	// Services lists the Services to create for the Webserver, all selecting
+	// its pods. When empty, a single ClusterIP Service named after the
+	// Webserver is created. Services removed from the list are deleted.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Services []ServiceSpec `json:"services,omitempty"`
+
+	// ServiceName names the Service created when Services is empty. It
+	// defaults to the Webserver's name. Renaming it deletes the Service
+	// created under the old name.
+	// +optional
+	ServiceName string `json:"serviceName,omitempty"`
+
+	// RouteName names the Route or HTTPRoute. It defaults to the Webserver's
+	// name. Renaming it deletes the object created under the old name.
+	// +optional
+	RouteName string `json:"routeName,omitempty"`
+
+	// RouteService names the entry in Services that the Route or HTTPRoute
+	// targets and the reachability check uses. It defaults to the first
+	// entry.
+	// +optional
+	RouteService string `json:"routeService,omitempty"`
+
+	// RouteTimeout is how long the OpenShift router waits for a response
+	// before failing the request, such as 2m for long polling. The router
+	// default, usually 30s, applies when unset. It is rounded down to whole
+	// milliseconds and ignored for HTTPRoutes.
+	// +optional
+	RouteTimeout *metav1.Duration `json:"routeTimeout,omitempty"`
+
+	// RouteMetadata selects whether the operator merges its labels and
+	// annotations into the Route's, leaving ones added by the router, users
+	// or other tools alone, or replaces them so that the Route carries only
+	// its own.
+	// +kubebuilder:default=Merge
+	// +optional
+	RouteMetadata RouteMetadataPolicy `json:"routeMetadata,omitempty"`
+
+	// TopologyAwareRouting asks kube-proxy to keep Service traffic within the
+	// client's zone when possible, by setting the
+	// service.kubernetes.io/topology-mode annotation to Auto on every
+	// Service.
+	// +optional
+	TopologyAwareRouting bool `json:"topologyAwareRouting,omitempty"`
+
+	// PublishNotReadyAddresses lists pods in every Service's endpoints
+	// before they are ready, so that peers can discover each other while
+	// starting, as some clustered servers need to bootstrap. Clients of the
+	// Services may then reach pods that are not ready.
+	// +optional
+	PublishNotReadyAddresses bool `json:"publishNotReadyAddresses,omitempty"`
+
+	// CreateService controls whether the operator creates Services for the
+	// Webserver. Setting it to false removes the Services the operator
+	// created earlier and disables the reachability check.
+	// +kubebuilder:default=true
+	// +optional
+	CreateService *bool `json:"createService,omitempty"`
+
+	// CreateRoute controls whether the operator creates a Route for the
+	// Webserver. Setting it to false removes a Route the operator created
+	// earlier.
+	// +kubebuilder:default=true
+	// +optional
+	CreateRoute *bool `json:"createRoute,omitempty"`
+
+	// ExposeVia selects whether the Webserver is exposed through an OpenShift
+	// Route, a Gateway API HTTPRoute or an Ingress. Gateway requires Gateway
+	// to be set and the HTTPRoute CRD to be installed. CreateRoute=false
+	// disables all of them.
+	// +kubebuilder:default=Route
+	// +optional
+	ExposeVia ExposurePolicy `json:"exposeVia,omitempty"`
+
+	// Gateway configures the HTTPRoute used when ExposeVia is Gateway.
+	// +optional
+	Gateway *GatewayExposure `json:"gateway,omitempty"`
+
+	// IngressClassName selects the IngressClass of the Ingress used when
+	// ExposeVia is Ingress. The cluster's default class applies when unset.
+	// +optional
+	IngressClassName *string `json:"ingressClassName,omitempty"`
+
+	// IngressAnnotations are set on the Ingress, for settings specific to
+	// the ingress controller such as nginx rewrite rules. Annotations
+	// removed from here are removed from the Ingress.
+	// +optional
+	IngressAnnotations map[string]string `json:"ingressAnnotations,omitempty"`
+
+	// IngressHost is the host the Ingress matches. When empty, it matches
+	// every host.
+	// +optional
+	IngressHost string `json:"ingressHost,omitempty"`
+
+	// ProbeScheme adds HTTP GET liveness and readiness probes for "/" on the
+	// http port, sent with the given scheme. Use HTTPS when the container
+	// serves TLS directly. No probes are generated when neither it nor
+	// HealthPort is set.
+	// +kubebuilder:validation:Enum=HTTP;HTTPS
+	// +optional
+	ProbeScheme corev1.URIScheme `json:"probeScheme,omitempty"`
+
+	// HealthPort is a container port, other than the 8080 serving port, that
+	// the liveness and readiness probes target instead. It is declared on
+	// the container as "health" but not exposed through the Services or
+	// Route. Setting it enables the probes, over HTTP unless ProbeScheme
+	// says otherwise.
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	HealthPort int32 `json:"healthPort,omitempty"`
+
+	// ProbeTiming loosens or tightens the generated liveness and readiness
+	// probes. Unset fields keep the Kubernetes defaults.
+	// +optional
+	ProbeTiming *ProbeTiming `json:"probeTiming,omitempty"`
+
+	// MemoryLivenessLimit restarts the webserver container when its resident
+	// memory exceeds the limit, such as when httpd modules leak. The
+	// liveness probe becomes a command that reads the container's memory
+	// cgroup and, when HTTP probes are configured, also requests "/" with
+	// curl, so the image needs /bin/sh, cat, awk and, for HTTP, curl.
+	// +optional
+	MemoryLivenessLimit *resource.Quantity `json:"memoryLivenessLimit,omitempty"`
+
+	// ZeroDowntime makes rollouts and scale-downs drain connections before
+	// pods stop: a stopping pod keeps serving for DrainSeconds while its
+	// removal from the Service endpoints and Route propagates, rollouts
+	// never take a ready pod away before its replacement is ready, and a
+	// TCP readiness probe is added when no probes are configured.
+	// +optional
+	ZeroDowntime bool `json:"zeroDowntime,omitempty"`
+
+	// DrainSeconds is how long a stopping pod keeps serving when
+	// ZeroDowntime is set. It must cover the time kube-proxy and the
+	// ingress routers take to drop the pod, typically a few seconds.
+	// +kubebuilder:default=15
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	DrainSeconds int32 `json:"drainSeconds,omitempty"`
+
+	// ChangeReason describes why the Webserver was last changed. It is set
+	// as the kubernetes.io/change-cause annotation of the Deployment, which
+	// kubectl rollout history shows for each revision. When empty, the
+	// Webserver's own kubernetes.io/change-cause annotation is used.
+	// +optional
+	ChangeReason string `json:"changeReason,omitempty"`
+
+	// PauseRollout pauses the Deployment, so spec changes are staged but not
+	// rolled out until it is cleared.
+	// +optional
+	PauseRollout bool `json:"pauseRollout,omitempty"`
+
+	// AutomountServiceAccountToken controls whether the pods mount a token
+	// for their ServiceAccount. The cluster default applies when unset.
+	// +optional
+	AutomountServiceAccountToken *bool `json:"automountServiceAccountToken,omitempty"`
+
+	// StableAfter is how long every replica must have been continuously
+	// ready before the Stable condition becomes True. Defaults to 5m.
+	// +optional
+	StableAfter *metav1.Duration `json:"stableAfter,omitempty"`
+
+	// SizeProfile picks predefined resource requests and limits for the
+	// webserver container. The operator's defaults can be tuned per cluster.
+	// +optional
+	SizeProfile SizeProfile `json:"sizeProfile,omitempty"`
+
+	// Resources sets the webserver container's resource requests and
+	// limits. Each quantity given here overrides the one from SizeProfile.
+	// +optional
+	Resources *corev1.ResourceRequirements `json:"resources,omitempty"`
+
+	// Httpd tunes httpd through the environment variables the default
+	// image reads, so the variable names need not be known. Other images
+	// may ignore them.
+	// +optional
+	Httpd *HttpdSettings `json:"httpd,omitempty"`
+
+	// Env sets environment variables on the webserver container. A
+	// variable set here overrides one derived from Httpd.
+	// +optional
+	Env []corev1.EnvVar `json:"env,omitempty"`
+
+	// SecurityContext sets the webserver container's security context. When
+	// it is unset and the namespace enforces the restricted Pod Security
+	// Standard, the admission webhook fills in a context that complies.
+	// +optional
+	SecurityContext *corev1.SecurityContext `json:"securityContext,omitempty"`
+
+	// WorkingDir sets the webserver container's working directory. The
+	// image's default is used when it is unset.
+	// +optional
+	WorkingDir string `json:"workingDir,omitempty"`
+
+	// TerminationMessagePath is the file, mounted into the webserver
+	// container, that it writes its termination message to. Defaults to
+	// /dev/termination-log.
+	// +optional
+	TerminationMessagePath string `json:"terminationMessagePath,omitempty"`
+
+	// TerminationMessagePolicy controls how the webserver container's
+	// termination message is populated. FallbackToLogsOnError uses the tail
+	// of the container log when the message file is empty and the container
+	// failed.
+	// +kubebuilder:validation:Enum=File;FallbackToLogsOnError
+	// +kubebuilder:default=FallbackToLogsOnError
+	// +optional
+	TerminationMessagePolicy corev1.TerminationMessagePolicy `json:"terminationMessagePolicy,omitempty"`
+
+	// PodSpecPatch is a strategic merge patch applied to the generated pod
+	// spec, for fields the Webserver does not model. It may not remove or
+	// rename the webserver container. Changes to it roll the pods.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Type=object
+	// +optional
+	PodSpecPatch *runtime.RawExtension `json:"podSpecPatch,omitempty"`
+
+	// ConfigConfigMap names a ConfigMap in the target namespace that is
+	// mounted over the httpd conf directory, so it must provide httpd.conf.
+	// Changes to its data roll the pods.
+	// +optional
+	ConfigConfigMap string `json:"configConfigMap,omitempty"`
+
+	// TLS mounts a kubernetes.io/tls Secret, such as one issued by
+	// cert-manager, into the webserver container and reports when its
+	// certificate is about to expire.
+	// +optional
+	TLS *TLSCertificate `json:"tls,omitempty"`
+
+	// ServiceAccountToken projects a token for the pods' ServiceAccount,
+	// bound to an audience such as an external service, into the webserver
+	// container. The kubelet refreshes it before it expires. It is
+	// independent of AutomountServiceAccountToken.
+	// +optional
+	ServiceAccountToken *ProjectedServiceAccountToken `json:"serviceAccountToken,omitempty"`
+
+	// Storage gives each pod of a StatefulSet its own PersistentVolumeClaim,
+	// mounted over the httpd document root. It requires WorkloadType
+	// StatefulSet. A StatefulSet's claim templates cannot change, so it
+	// only takes effect when the StatefulSet is created, and the claims are
+	// kept when it is deleted.
+	// +optional
+	Storage *WebserverStorage `json:"storage,omitempty"`
+
+	// TemplateRef names a ConfigMap in the target namespace holding a base
+	// pod template, such as an organization's standard Deployment, that
+	// the generated pod template is overlaid onto. The Webserver's own
+	// fields take precedence. Without the ConfigMap the generated pod
+	// template is used as is. Changes to the template roll the pods.
+	// +optional
+	TemplateRef *TemplateReference `json:"templateRef,omitempty"`
+}
+
+// TLSCertificate references the certificate a Webserver serves.
+type TLSCertificate struct {
+	// SecretName names a kubernetes.io/tls Secret in the target namespace.
+	// Its tls.crt and tls.key are mounted read-only at
+	// /opt/rh/httpd24/root/etc/httpd/tls for the httpd configuration to
+	// use. Rotating the Secret rolls the pods.
+	SecretName string `json:"secretName"`
+
+	// ExpiryWarning is how long before the certificate expires the
+	// CertificateExpiring condition becomes True.
+	// +kubebuilder:default="720h"
+	// +optional
+	ExpiryWarning *metav1.Duration `json:"expiryWarning,omitempty"`
+}
+
+// ProjectedServiceAccountToken describes a ServiceAccount token projected
+// into the webserver container.
+type ProjectedServiceAccountToken struct {
+	// Audience is the audience the token is bound to. The service the
+	// token is presented to must accept it.
+	// +kubebuilder:validation:MinLength=1
+	Audience string `json:"audience"`
+
+	// ExpirationSeconds is how long the token is valid. The API server may
+	// shorten it.
+	// +kubebuilder:default=3600
+	// +kubebuilder:validation:Minimum=600
+	// +optional
+	ExpirationSeconds *int64 `json:"expirationSeconds,omitempty"`
+
+	// Path is the file the token is written to. Its directory is mounted
+	// read-only and holds only the token.
+	// +kubebuilder:default="/var/run/secrets/tokens/token"
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// WebserverStorage describes the PersistentVolumeClaim of each pod.
+type WebserverStorage struct {
+	// Size is the storage requested for each pod.
+	Size resource.Quantity `json:"size"`
+
+	// StorageClassName selects the StorageClass of the claims. The
+	// cluster's default class applies when unset.
+	// +optional
+	StorageClassName *string `json:"storageClassName,omitempty"`
+
+	// AccessModes of the claims. They default to ReadWriteOnce.
+	// +optional
+	AccessModes []corev1.PersistentVolumeAccessMode `json:"accessModes,omitempty"`
+}
+
+// TemplateReference selects a base pod template stored in a ConfigMap.
+type TemplateReference struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+
+	// Key is the ConfigMap key holding the template: a Deployment manifest,
+	// of which only the pod template is used, or a bare PodSpec, in YAML
+	// or JSON.
+	// +kubebuilder:default="template.yaml"
+	// +optional
+	Key string `json:"key,omitempty"`
+}
+
+// WebserverMonitoring sets the thresholds of a Webserver's default alerts.
+type WebserverMonitoring struct {
+	// NotReadyFor is how long the Webserver may stay not ready before the
+	// WebserverNotReady alert fires.
+	// +kubebuilder:default="10m"
+	// +optional
+	NotReadyFor *metav1.Duration `json:"notReadyFor,omitempty"`
+
+	// RestartThreshold is how many container restarts within RestartWindow
+	// fire the WebserverRestarting alert.
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	RestartThreshold int32 `json:"restartThreshold,omitempty"`
+
+	// RestartWindow is the window RestartThreshold counts restarts over.
+	// +kubebuilder:default="15m"
+	// +optional
+	RestartWindow *metav1.Duration `json:"restartWindow,omitempty"`
+}
+
+// InlineConfigMap is a ConfigMap declared in a Webserver's spec.
+type InlineConfigMap struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+
+	// Data is the ConfigMap's data.
+	// +optional
+	Data map[string]string `json:"data,omitempty"`
 }
 
+// TemporaryToleration is a pod toleration that the operator removes once it
+// expires.
+type TemporaryToleration struct {
+	corev1.Toleration `json:",inline"`
+
+	// ExpiresAt is when the operator removes the toleration from the pods.
+	ExpiresAt metav1.Time `json:"expiresAt"`
+}
+
+// ServiceSpec describes one of a Webserver's Services.
+type ServiceSpec struct {
+	// Name is the name of the Service.
+	Name string `json:"name"`
+
+	// Type is the Service type.
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	// +optional
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Port is the port the Service exposes. It is forwarded to httpd's http
+	// port.
+	// +kubebuilder:default=8080
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +optional
+	Port int32 `json:"port,omitempty"`
+
+	// Protocol is the protocol of the Service's port, for a webserver that
+	// also listens for UDP or SCTP on its serving port. The webserver
+	// container declares the serving port for each protocol in use. The
+	// Service that the Route, HTTPRoute or Ingress targets must use TCP.
+	// +kubebuilder:validation:Enum=TCP;UDP;SCTP
+	// +kubebuilder:default=TCP
+	// +optional
+	Protocol corev1.Protocol `json:"protocol,omitempty"`
+
+	// AppProtocol is the application protocol of the Service's port, such
+	// as h2c or https. It defaults to the Webserver's appProtocol, and may
+	// only be set for TCP.
+	// +optional
+	AppProtocol string `json:"appProtocol,omitempty"`
+}
+
+// SizeProfile names a predefined set of container resources.
+// +kubebuilder:validation:Enum=small;medium;large
+type SizeProfile string
+
+const (
+	// SizeProfileSmall suits low-traffic or development Webservers.
+	SizeProfileSmall SizeProfile = "small"
+
+	// SizeProfileMedium suits typical production Webservers.
+	SizeProfileMedium SizeProfile = "medium"
+
+	// SizeProfileLarge suits high-traffic Webservers.
+	SizeProfileLarge SizeProfile = "large"
+)
+
+// HttpdSettings are httpd options of the default rhscl httpd image. Unset
+// options keep the image's defaults.
+type HttpdSettings struct {
+	// MPM selects the multi-processing module, as HTTPD_MPM.
+	// +kubebuilder:validation:Enum=event;worker;prefork
+	// +optional
+	MPM string `json:"mpm,omitempty"`
+
+	// MaxRequestWorkers limits the simultaneous requests served, as
+	// HTTPD_MAX_REQUEST_WORKERS.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	MaxRequestWorkers int32 `json:"maxRequestWorkers,omitempty"`
+
+	// StartServers is the number of child processes created at startup, as
+	// HTTPD_START_SERVERS.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	StartServers int32 `json:"startServers,omitempty"`
+}
+
+// ScaleSchedule scales a Webserver at the times its rules fire.
+type ScaleSchedule struct {
+	// TimeZone is the IANA time zone, such as Europe/Paris, in which the
+	// rules' schedules are evaluated.
+	// +kubebuilder:default=UTC
+	// +optional
+	TimeZone string `json:"timeZone,omitempty"`
+
+	// Rules set the replica count at the times their schedules fire. The
+	// rule that fired most recently applies.
+	// +kubebuilder:validation:MinItems=1
+	Rules []ScaleRule `json:"rules"`
+}
+
+// ScaleRule sets the replica count when its schedule fires.
+type ScaleRule struct {
+	// Schedule is a five-field cron expression, such as "0 20 * * 1-5",
+	// or a descriptor such as "@daily".
+	Schedule string `json:"schedule"`
+
+	// Replicas is the number of pods to run from the time the schedule
+	// fires until another rule fires.
+	// +kubebuilder:validation:Minimum=0
+	Replicas int32 `json:"replicas"`
+}
+
+// ProbeTiming sets the timing of the probes the operator generates.
+type ProbeTiming struct {
+	// PeriodSeconds is how often the probes run.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+
+	// TimeoutSeconds is how long a probe may take before it fails.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// FailureThreshold is how many probes in a row must fail before the
+	// container is restarted or marked unready.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+
+	// SuccessThreshold is how many probes in a row must succeed before an
+	// unready container is marked ready. It only applies to the readiness
+	// probe; Kubernetes requires 1 for liveness.
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+}
+
+// GatewayExposure configures a Gateway API HTTPRoute for a Webserver.
+type GatewayExposure struct {
+	// ParentName is the name of the Gateway the HTTPRoute attaches to.
+	ParentName string `json:"parentName"`
+
+	// ParentNamespace is the namespace of the Gateway. It defaults to the
+	// HTTPRoute's namespace.
+	// +optional
+	ParentNamespace string `json:"parentNamespace,omitempty"`
+
+	// SectionName attaches the HTTPRoute to a single listener of the
+	// Gateway.
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+
+	// Hostname is the host the HTTPRoute matches. When empty, the hostnames
+	// of the Gateway's listeners apply.
+	// +optional
+	Hostname string `json:"hostname,omitempty"`
+
+	// Path is the path prefix routed to the Webserver.
+	// +kubebuilder:default="/"
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// ReachabilityCheck configures the operator's HTTP check of a Webserver.
+type ReachabilityCheck struct {
+	// Path is the URL path requested from the Service.
+	// +kubebuilder:default="/"
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// ExpectedStatus is the HTTP status code that marks the Webserver as
+	// reachable.
+	// +kubebuilder:default=200
+	// +kubebuilder:validation:Minimum=100
+	// +kubebuilder:validation:Maximum=599
+	// +optional
+	ExpectedStatus int32 `json:"expectedStatus,omitempty"`
+
+	// TimeoutSeconds bounds each request.
+	// +kubebuilder:default=5
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+
+	// PeriodSeconds is the interval between checks.
+	// +kubebuilder:default=60
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+}
+
+// SelfHealPolicy describes the recovery action taken for a degraded rollout.
+// +kubebuilder:validation:Enum=Restart;Rollback
+type SelfHealPolicy string
+
+const (
+	// SelfHealRestart triggers a rollout restart of the Deployment.
+	SelfHealRestart SelfHealPolicy = "Restart"
+
+	// SelfHealRollback reverts the pod template to the last known good
+	// ReplicaSet recorded in status.
+	SelfHealRollback SelfHealPolicy = "Rollback"
+)
+
+// ExposurePolicy describes how a Webserver is exposed outside the cluster.
+// +kubebuilder:validation:Enum=Route;Gateway;Ingress
+type ExposurePolicy string
+
+const (
+	// ExposeViaRoute exposes the Webserver through an OpenShift Route.
+	ExposeViaRoute ExposurePolicy = "Route"
+
+	// ExposeViaGateway exposes the Webserver through a Gateway API
+	// HTTPRoute.
+	ExposeViaGateway ExposurePolicy = "Gateway"
+
+	// ExposeViaIngress exposes the Webserver through a networking.k8s.io
+	// Ingress.
+	ExposeViaIngress ExposurePolicy = "Ingress"
+)
+
+// RouteMetadataPolicy describes how the operator manages the Route's labels
+// and annotations.
+// +kubebuilder:validation:Enum=Merge;Replace
+type RouteMetadataPolicy string
+
+const (
+	// RouteMetadataMerge sets the operator's labels and annotations on the
+	// Route and leaves the others, such as openshift.io/host.generated.
+	RouteMetadataMerge RouteMetadataPolicy = "Merge"
+
+	// RouteMetadataReplace makes the Route's labels and annotations exactly
+	// the operator's, removing any others.
+	RouteMetadataReplace RouteMetadataPolicy = "Replace"
+)
+
+// WorkloadType names the kind of workload that runs a Webserver's pods.
+// +kubebuilder:validation:Enum=Deployment;DaemonSet;StatefulSet
+type WorkloadType string
+
+const (
+	// WorkloadDeployment runs Count pods from a Deployment.
+	WorkloadDeployment WorkloadType = "Deployment"
+
+	// WorkloadDaemonSet runs one pod per node from a DaemonSet.
+	WorkloadDaemonSet WorkloadType = "DaemonSet"
+
+	// WorkloadStatefulSet runs Count pods with stable identities from a
+	// StatefulSet.
+	WorkloadStatefulSet WorkloadType = "StatefulSet"
+)
+
+// HeadlessServiceSuffix is appended to the Webserver's name to name the
+// headless Service that gives a StatefulSet's pods their DNS entries.
+const HeadlessServiceSuffix = "-headless"
+
 // WebserverStatus defines the observed state of Webserver
 type WebserverStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// Conditions describe the latest observations of the Webserver's state.
+	// +patchMergeKey=type
+	// +patchStrategy=merge
+	// +listType=map
+	// +listMapKey=type
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type"`
+
+	// Phase summarizes the state of the Webserver's rollout.
+	// +optional
+	Phase WebserverPhase `json:"phase,omitempty"`
+
+	// Resources records when the operator last applied each owned object.
+	// +optional
+	Resources OwnedResourcesStatus `json:"resources,omitempty"`
+
+	// Objects records what the latest reconcile did to each owned object,
+	// keyed by kind/name, for example "Service/web".
+	// +optional
+	Objects map[string]ObjectAction `json:"objects,omitempty"`
+
+	// Summary describes the readiness of the Webserver's pods, for example
+	// "3/5 ready, 1 pending, 1 crashloop".
+	// +optional
+	Summary string `json:"summary,omitempty"`
+
+	// Pods lists the Webserver's pods, sorted by name and capped at 25
+	// entries.
+	// +optional
+	Pods []PodInfo `json:"pods,omitempty"`
+
+	// ImageID is the image the Webserver's ready pods are running, as
+	// reported by the kubelet. It includes the resolved digest.
+	// +optional
+	ImageID string `json:"imageID,omitempty"`
+
+	// Host is the hostname assigned to the Webserver's Route.
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// AdmittedHost is the host the router last admitted the Webserver's
+	// Route with. A change to it is reported in the HostChanged condition.
+	// +optional
+	AdmittedHost string `json:"admittedHost,omitempty"`
+
+	// TargetNamespace is the namespace the Webserver's resources were last
+	// created in.
+	// +optional
+	TargetNamespace string `json:"targetNamespace,omitempty"`
+
+	// LastKnownGoodHash is the pod-template-hash of the most recent
+	// ReplicaSet whose rollout completed successfully.
+	// +optional
+	LastKnownGoodHash string `json:"lastKnownGoodHash,omitempty"`
+
+	// SelfHealedGeneration is the Webserver generation for which a self-heal
+	// action was last taken. The operator stops re-applying the pod template
+	// for that generation so the recovery is not immediately undone.
+	// +optional
+	SelfHealedGeneration int64 `json:"selfHealedGeneration,omitempty"`
+
+	// RollbackAttempts counts the automatic rollbacks since a rollout of
+	// the Webserver's own pod template last completed. The operator stops
+	// rolling back once it reaches the manager's --max-rollback-attempts.
+	// +optional
+	RollbackAttempts int32 `json:"rollbackAttempts,omitempty"`
+
+	// LastRollbackTime is when the operator last rolled the Deployment back
+	// automatically.
+	// +optional
+	LastRollbackTime *metav1.Time `json:"lastRollbackTime,omitempty"`
+
+	// DefaultImage is the operator's default image the pods were last rolled
+	// out with, when Spec.Image is empty.
+	// +optional
+	DefaultImage string `json:"defaultImage,omitempty"`
+
+	// SelectorLabels are the labels the live workload selects its pods by,
+	// fixed when it was created.
+	// +optional
+	SelectorLabels map[string]string `json:"selectorLabels,omitempty"`
+
+	// ReadySince is when every replica of the current generation last
+	// became ready. It is cleared as soon as a replica is not ready.
+	// +optional
+	ReadySince *metav1.Time `json:"readySince,omitempty"`
+
+	// LastReachabilityCheck is when the operator last ran the reachability
+	// check. The check runs again once Spec.ReachabilityCheck.PeriodSeconds
+	// have passed, however often the Webserver is reconciled.
+	// +optional
+	LastReachabilityCheck *metav1.Time `json:"lastReachabilityCheck,omitempty"`
+
+	// CertificateNotAfter is when the certificate in the TLS Secret
+	// expires.
+	// +optional
+	CertificateNotAfter *metav1.Time `json:"certificateNotAfter,omitempty"`
+
+	// OperatorVersion is the version of the operator that last reconciled
+	// the Webserver without errors.
+	// +optional
+	OperatorVersion string `json:"operatorVersion,omitempty"`
+}
+
+// PodInfo describes one of a Webserver's pods.
+type PodInfo struct {
+	// Name is the pod's name.
+	Name string `json:"name"`
+
+	// Phase is the pod's lifecycle phase.
+	// +optional
+	Phase corev1.PodPhase `json:"phase,omitempty"`
+
+	// RestartCount is the total number of restarts of the pod's containers.
+	// +optional
+	RestartCount int32 `json:"restartCount,omitempty"`
+}
+
+// WebserverPhase is a high-level summary of a Webserver's rollout.
+type WebserverPhase string
+
+const (
+	// PhasePending means the Deployment has not been picked up by the
+	// Deployment controller yet.
+	PhasePending WebserverPhase = "Pending"
+
+	// PhaseProgressing means a rollout is under way.
+	PhaseProgressing WebserverPhase = "Progressing"
+
+	// PhaseReady means every replica runs the current pod template and is
+	// available.
+	PhaseReady WebserverPhase = "Ready"
+
+	// PhasePaused means the rollout is paused by PauseRollout.
+	PhasePaused WebserverPhase = "Paused"
+
+	// PhaseDegraded means the rollout exceeded its progress deadline or pods
+	// are crash looping.
+	PhaseDegraded WebserverPhase = "Degraded"
+)
+
+// OwnedResourcesStatus records the operator's writes to each owned object.
+type OwnedResourcesStatus struct {
+	// +optional
+	Deployment ResourceStatus `json:"deployment,omitempty"`
+
+	// +optional
+	DaemonSet ResourceStatus `json:"daemonSet,omitempty"`
+
+	// +optional
+	StatefulSet ResourceStatus `json:"statefulSet,omitempty"`
+
+	// +optional
+	Service ResourceStatus `json:"service,omitempty"`
+
+	// +optional
+	Route ResourceStatus `json:"route,omitempty"`
+
+	// +optional
+	HTTPRoute ResourceStatus `json:"httpRoute,omitempty"`
+
+	// +optional
+	Ingress ResourceStatus `json:"ingress,omitempty"`
+
+	// +optional
+	ExtraConfigMaps ResourceStatus `json:"extraConfigMaps,omitempty"`
+
+	// +optional
+	PrometheusRule ResourceStatus `json:"prometheusRule,omitempty"`
+}
+
+// ReconcileAction is what a reconcile did to an owned object.
+// +kubebuilder:validation:Enum=Created;Updated;Unchanged;Failed
+type ReconcileAction string
+
+const (
+	// ActionCreated means the object did not exist and was created.
+	ActionCreated ReconcileAction = "Created"
+
+	// ActionUpdated means the object was changed to match the Webserver.
+	ActionUpdated ReconcileAction = "Updated"
+
+	// ActionUnchanged means the object already matched the Webserver.
+	ActionUnchanged ReconcileAction = "Unchanged"
+
+	// ActionFailed means the object could not be created or updated.
+	ActionFailed ReconcileAction = "Failed"
+)
+
+// ObjectAction records what the latest reconcile did to an owned object.
+type ObjectAction struct {
+	// Action is what the latest reconcile did to the object.
+	Action ReconcileAction `json:"action"`
+
+	// Time is when the object was last created or updated, or when it
+	// became unchanged or started failing.
+	Time metav1.Time `json:"time"`
 }
 
+// ResourceStatus records the operator's writes to a single owned object.
+type ResourceStatus struct {
+	// LastAppliedTime is when the operator last created or changed the
+	// object.
+	// +optional
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+}
+
+const (
+	// ConditionReachable reports the result of the reachability check.
+	ConditionReachable = "Reachable"
+
+	// ConditionDeploymentApplied reports whether the Deployment could be
+	// created or updated.
+	ConditionDeploymentApplied = "DeploymentApplied"
+
+	// ConditionDaemonSetApplied reports whether the DaemonSet could be
+	// created or updated.
+	ConditionDaemonSetApplied = "DaemonSetApplied"
+
+	// ConditionStatefulSetApplied reports whether the StatefulSet could be
+	// created or updated.
+	ConditionStatefulSetApplied = "StatefulSetApplied"
+
+	// ConditionServiceApplied reports whether the Service could be created
+	// or updated.
+	ConditionServiceApplied = "ServiceApplied"
+
+	// ConditionRouteApplied reports whether the Route could be created.
+	ConditionRouteApplied = "RouteApplied"
+
+	// ConditionHTTPRouteApplied reports whether the Gateway API HTTPRoute
+	// could be created or updated.
+	ConditionHTTPRouteApplied = "HTTPRouteApplied"
+
+	// ConditionIngressApplied reports whether the Ingress could be created
+	// or updated.
+	ConditionIngressApplied = "IngressApplied"
+
+	// ConditionExtraConfigMapsApplied reports whether the ExtraConfigMaps
+	// could be created or updated.
+	ConditionExtraConfigMapsApplied = "ExtraConfigMapsApplied"
+
+	// ConditionPrometheusRuleApplied reports whether the PrometheusRule of
+	// default alerts could be created or updated, or whether its CRD is
+	// missing.
+	ConditionPrometheusRuleApplied = "PrometheusRuleApplied"
+
+	// ConditionHostChanged reports that the router admitted the Route with
+	// a different host than before, which breaks DNS records pointing at
+	// the old one. It stays True until the Webserver's spec next changes.
+	ConditionHostChanged = "HostChanged"
+
+	// ConditionSelectorUpToDate reports whether the Deployment's immutable
+	// selector matches the one the Webserver currently asks for.
+	ConditionSelectorUpToDate = "SelectorUpToDate"
+
+	// ConditionConfigMapAvailable reports whether the ConfigConfigMap
+	// exists.
+	ConditionConfigMapAvailable = "ConfigMapAvailable"
+
+	// ConditionCertificateExpiring reports whether the certificate in the
+	// TLS Secret expires within the ExpiryWarning window, or has expired.
+	ConditionCertificateExpiring = "CertificateExpiring"
+
+	// ConditionOperatorUpToDate reports whether the running operator
+	// version has reconciled the Webserver since it started. It turns False
+	// when an upgraded operator starts and True once the new version has
+	// reconciled the Webserver without errors.
+	ConditionOperatorUpToDate = "OperatorUpToDate"
+
+	// ConditionRecreateHeld reports owned objects that were deleted outside
+	// the operator and are left deleted until the recreate delay passes.
+	ConditionRecreateHeld = "RecreateHeld"
+
+	// ConditionTemplateApplied reports whether the base pod template named
+	// by TemplateRef was found and overlaid.
+	ConditionTemplateApplied = "TemplateApplied"
+
+	// ConditionStable reports whether every replica has been ready for at
+	// least StableAfter.
+	ConditionStable = "Stable"
+
+	// ConditionWaitingForDependency reports whether the operator is holding
+	// off on applying the Deployment because an object its pods reference,
+	// such as the ConfigConfigMap, does not exist yet.
+	ConditionWaitingForDependency = "WaitingForDependency"
+
+	// ConditionDegraded reports whether the rollout has exceeded its
+	// progress deadline or pods are crash looping, with the last
+	// termination message of a crashing container.
+	ConditionDegraded = "Degraded"
+
+	// ConditionVolumesShareable reports whether every PersistentVolumeClaim
+	// the pods mount can be mounted by all replicas at once. It is False when
+	// a ReadWriteOnce claim is mounted by more than one replica.
+	ConditionVolumesShareable = "VolumesShareable"
+
+	// ConditionDrifted reports, in observe mode, whether the owned objects
+	// differ from what the Webserver asks for, with the changes the operator
+	// held back. It is only set in observe mode.
+	ConditionDrifted = "Drifted"
+
+	// ConditionQuotaExceeded reports whether a ResourceQuota in the target
+	// namespace is rejecting the Webserver's objects or pods, naming the
+	// quota.
+	ConditionQuotaExceeded = "QuotaExceeded"
+
+	// ConditionInvalidSpec reports whether the spec has problems that the
+	// validating webhook would have rejected, listing all of them. While it
+	// is True the operator leaves the owned objects as they are.
+	ConditionInvalidSpec = "InvalidSpec"
+
+	// ConditionLoadBalancerProvisioned reports whether every LoadBalancer
+	// Service has been given an external address. It is False, naming the
+	// Services, while the cluster has not provisioned one, as happens on
+	// clusters without a load balancer provider.
+	ConditionLoadBalancerProvisioned = "LoadBalancerProvisioned"
+)
+
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Count",type=integer,JSONPath=`.spec.count`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Status",type=string,JSONPath=`.status.summary`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // Webserver is the Schema for the webservers API
 type Webserver struct {
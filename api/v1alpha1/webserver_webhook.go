@@ -0,0 +1,351 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apivalidation "k8s.io/apimachinery/pkg/api/validation"
+	metav1validation "k8s.io/apimachinery/pkg/apis/meta/v1/validation"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var webserverlog = logf.Log.WithName("webserver-resource")
+
+// RequiredLabels lists the labels every Webserver must carry. The manager
+// sets it from --required-labels; empty means no labels are required.
+var RequiredLabels []string
+
+// AllowedServiceTypes lists the Service types Webservers may ask for, such
+// as ClusterIP and NodePort on a cluster without a load balancer provider.
+// The manager sets it from --allowed-service-types; empty allows all types.
+var AllowedServiceTypes []corev1.ServiceType
+
+func (r *Webserver) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	decoder, err := admission.NewDecoder(mgr.GetScheme())
+	if err != nil {
+		return err
+	}
+	mgr.GetWebhookServer().Register(defaultingWebhookPath, &webhook.Admission{
+		Handler: &webserverDefaulter{reader: mgr.GetAPIReader(), decoder: decoder},
+	})
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-servers-redhat-com-v1alpha1-webserver,mutating=false,failurePolicy=fail,sideEffects=None,groups=servers.redhat.com,resources=webservers,verbs=create;update,versions=v1alpha1,name=vwebserver.kb.io,admissionReviewVersions={v1,v1beta1}
+
+var _ webhook.Validator = &Webserver{}
+
+// ValidateCreate implements webhook.Validator so a webhook will be registered for the type
+func (r *Webserver) ValidateCreate() error {
+	webserverlog.Info("validate create", "name", r.Name)
+	return r.validate()
+}
+
+// ValidateUpdate implements webhook.Validator so a webhook will be registered for the type
+func (r *Webserver) ValidateUpdate(old runtime.Object) error {
+	webserverlog.Info("validate update", "name", r.Name)
+	if err := r.validate(); err != nil {
+		return err
+	}
+	previous, ok := old.(*Webserver)
+	if !ok || r.Spec.RecreateOnSelectorChange || equality.Semantic.DeepEqual(previous.PodSelector(), r.PodSelector()) {
+		return nil
+	}
+	if r.Spec.Selector == nil && previous.Spec.Selector == nil {
+		// SelectorLabels changes are accepted until the workload exists, and
+		// when they return to the selector it was created with.
+		live := previous.Status.SelectorLabels
+		if len(live) == 0 || equality.Semantic.DeepEqual(live, r.PodSelector()) {
+			return nil
+		}
+		return apierrors.NewInvalid(GroupVersion.WithKind("Webserver").GroupKind(), r.Name, field.ErrorList{
+			field.Forbidden(field.NewPath("spec", "selectorLabels"), "the workload was created with selector "+labels.FormatLabels(live)+
+				" and its selector cannot change in place; set spec.recreateOnSelectorChange to replace the Deployment"),
+		})
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Webserver").GroupKind(), r.Name, field.ErrorList{
+		field.Forbidden(field.NewPath("spec", "selector"), "the Deployment's selector cannot change in place; set spec.recreateOnSelectorChange to replace the Deployment"),
+	})
+}
+
+// ValidateDelete implements webhook.Validator so a webhook will be registered for the type
+func (r *Webserver) ValidateDelete() error {
+	return nil
+}
+
+// validate checks the Webserver's required labels and its spec.
+func (r *Webserver) validate() error {
+	var errs field.ErrorList
+	for _, key := range RequiredLabels {
+		if _, ok := r.Labels[key]; !ok {
+			errs = append(errs, field.Required(field.NewPath("metadata", "labels").Key(key), "label is required by cluster policy"))
+		}
+	}
+	errs = append(errs, r.ValidateSpec()...)
+	if len(errs) == 0 {
+		return nil
+	}
+	return apierrors.NewInvalid(GroupVersion.WithKind("Webserver").GroupKind(), r.Name, errs)
+}
+
+// ValidateSpec returns every problem with the spec. Besides the parts of the
+// spec that the CRD schema cannot express, it repeats the schema's range
+// checks, so that the controller can reject a Webserver stored before the
+// schema had them.
+func (r *Webserver) ValidateSpec() field.ErrorList {
+	var errs field.ErrorList
+	if r.Spec.Count != nil && *r.Spec.Count < 0 {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "count"), *r.Spec.Count, "must not be negative"))
+	}
+	if token := r.Spec.ServiceAccountToken; token != nil {
+		path := field.NewPath("spec", "serviceAccountToken")
+		if token.Audience == "" {
+			errs = append(errs, field.Required(path.Child("audience"), ""))
+		}
+		if seconds := token.ExpirationSeconds; seconds != nil && *seconds < 600 {
+			errs = append(errs, field.Invalid(path.Child("expirationSeconds"), *seconds, "must be at least 600"))
+		}
+		if p := token.Path; p != "" && (!filepath.IsAbs(p) || filepath.Clean(p) != p || filepath.Dir(p) == "/") {
+			errs = append(errs, field.Invalid(path.Child("path"), p, "must be a clean absolute file path outside /"))
+		} else {
+			errs = append(errs, r.validateTokenMount(path)...)
+		}
+	}
+	if limit := r.Spec.MemoryLivenessLimit; limit != nil && limit.Sign() <= 0 {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "memoryLivenessLimit"), limit.String(), "must be greater than zero"))
+	}
+	if d := r.Spec.ProgressDeadlineSeconds; d != nil && *d < 1 {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "progressDeadlineSeconds"), *d, "must be at least 1"))
+	}
+	if port := r.Spec.HealthPort; port != 0 {
+		for _, msg := range validation.IsValidPortNum(int(port)) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "healthPort"), port, msg))
+		}
+	}
+	routeService := 0
+	for i, service := range r.Spec.Services {
+		if service.Name == r.Spec.RouteService {
+			routeService = i
+		}
+		if !serviceTypeAllowed(service.Type) {
+			allowed := make([]string, len(AllowedServiceTypes))
+			for j, t := range AllowedServiceTypes {
+				allowed[j] = string(t)
+			}
+			errs = append(errs, field.NotSupported(field.NewPath("spec", "services").Index(i).Child("type"), service.Type, allowed))
+		}
+		switch service.Protocol {
+		case "", corev1.ProtocolTCP, corev1.ProtocolUDP, corev1.ProtocolSCTP:
+		default:
+			errs = append(errs, field.NotSupported(field.NewPath("spec", "services").Index(i).Child("protocol"), service.Protocol,
+				[]string{string(corev1.ProtocolTCP), string(corev1.ProtocolUDP), string(corev1.ProtocolSCTP)}))
+		}
+		if service.AppProtocol != "" && service.Protocol != "" && service.Protocol != corev1.ProtocolTCP {
+			errs = append(errs, field.Forbidden(field.NewPath("spec", "services").Index(i).Child("appProtocol"), "may only be set for TCP"))
+		}
+		if service.Port == 0 {
+			continue
+		}
+		for _, msg := range validation.IsValidPortNum(int(service.Port)) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "services").Index(i).Child("port"), service.Port, msg))
+		}
+	}
+	if len(r.Spec.Services) > 0 && (r.Spec.CreateRoute == nil || *r.Spec.CreateRoute) {
+		if protocol := r.Spec.Services[routeService].Protocol; protocol != "" && protocol != corev1.ProtocolTCP {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "services").Index(routeService).Child("protocol"), protocol,
+				"must be TCP for the Service the Route, HTTPRoute or Ingress targets"))
+		}
+	}
+	if r.Spec.Image != "" {
+		if err := validateImageReference(r.Spec.Image); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "image"), r.Spec.Image, err.Error()))
+		}
+	}
+	if r.Spec.ServiceName != "" && len(r.Spec.Services) > 0 {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "serviceName"), "may not be set together with spec.services, which names the Services itself"))
+	}
+	if r.Spec.RouteService != "" && len(r.Spec.Services) > 0 {
+		found := false
+		for _, service := range r.Spec.Services {
+			found = found || service.Name == r.Spec.RouteService
+		}
+		if !found {
+			errs = append(errs, field.NotFound(field.NewPath("spec", "routeService"), r.Spec.RouteService))
+		}
+	}
+	errs = append(errs, metav1validation.ValidateLabels(r.Spec.Selector, field.NewPath("spec", "selector"))...)
+	errs = append(errs, metav1validation.ValidateLabels(r.Spec.PodLabels, field.NewPath("spec", "podLabels"))...)
+	selector := r.PodSelector()
+	for k, v := range r.Spec.PodLabels {
+		if s, ok := selector[k]; ok && s != v {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "podLabels").Key(k), v, "conflicts with the selector label "+k+"="+s))
+		}
+	}
+	names := map[string]bool{WebserverContainerName: true}
+	for i, sidecar := range r.Spec.Sidecars {
+		if names[sidecar.Name] {
+			errs = append(errs, field.Duplicate(field.NewPath("spec", "sidecars").Index(i).Child("name"), sidecar.Name))
+		}
+		names[sidecar.Name] = true
+	}
+	if schedule := r.Spec.ScaleSchedule; schedule != nil {
+		if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "scaleSchedule", "timeZone"), schedule.TimeZone, err.Error()))
+		}
+		for i, rule := range schedule.Rules {
+			if _, err := cron.ParseStandard(rule.Schedule); err != nil {
+				errs = append(errs, field.Invalid(field.NewPath("spec", "scaleSchedule", "rules").Index(i).Child("schedule"), rule.Schedule, err.Error()))
+			}
+		}
+	}
+	if class := r.Spec.IngressClassName; class != nil {
+		for _, msg := range validation.IsDNS1123Subdomain(*class) {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "ingressClassName"), *class, msg))
+		}
+	}
+	errs = append(errs, apivalidation.ValidateAnnotations(r.Spec.IngressAnnotations, field.NewPath("spec", "ingressAnnotations"))...)
+	if host := r.Spec.IngressHost; host != "" {
+		msgs := validation.IsDNS1123Subdomain(host)
+		if strings.HasPrefix(host, "*.") {
+			msgs = validation.IsWildcardDNS1123Subdomain(host)
+		}
+		for _, msg := range msgs {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "ingressHost"), host, msg))
+		}
+	}
+	if r.Spec.ProgressDeadlineSeconds != nil && r.Spec.WorkloadType != "" && r.Spec.WorkloadType != WorkloadDeployment {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "progressDeadlineSeconds"),
+			"only applies to a Deployment; DaemonSets and StatefulSets have no progress deadline"))
+	}
+	if r.Spec.Storage != nil && r.Spec.WorkloadType != WorkloadStatefulSet {
+		errs = append(errs, field.Forbidden(field.NewPath("spec", "storage"), "requires spec.workloadType StatefulSet"))
+	}
+	if r.Spec.WorkloadType == WorkloadStatefulSet {
+		headless := r.Name + HeadlessServiceSuffix
+		for i, service := range r.Spec.Services {
+			if service.Name == headless {
+				errs = append(errs, field.Duplicate(field.NewPath("spec", "services").Index(i).Child("name"), service.Name))
+			}
+		}
+		if r.Spec.ServiceName == headless {
+			errs = append(errs, field.Duplicate(field.NewPath("spec", "serviceName"), r.Spec.ServiceName))
+		}
+	}
+	configMaps := map[string]bool{}
+	for i, configMap := range r.Spec.ExtraConfigMaps {
+		path := field.NewPath("spec", "extraConfigMaps").Index(i)
+		for _, msg := range validation.IsDNS1123Subdomain(configMap.Name) {
+			errs = append(errs, field.Invalid(path.Child("name"), configMap.Name, msg))
+		}
+		switch {
+		case configMaps[configMap.Name]:
+			errs = append(errs, field.Duplicate(path.Child("name"), configMap.Name))
+		case configMap.Name == r.Spec.ConfigConfigMap:
+			errs = append(errs, field.Invalid(path.Child("name"), configMap.Name, "collides with spec.configConfigMap, which the operator does not manage"))
+		case r.Spec.TemplateRef != nil && configMap.Name == r.Spec.TemplateRef.Name:
+			errs = append(errs, field.Invalid(path.Child("name"), configMap.Name, "collides with spec.templateRef, which the operator does not manage"))
+		}
+		configMaps[configMap.Name] = true
+		for key := range configMap.Data {
+			for _, msg := range validation.IsConfigMapKey(key) {
+				errs = append(errs, field.Invalid(path.Child("data").Key(key), key, msg))
+			}
+		}
+	}
+	if r.Spec.RouteTimeout != nil && r.Spec.RouteTimeout.Duration < time.Millisecond {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "routeTimeout"), r.Spec.RouteTimeout.Duration.String(), "must be at least 1ms"))
+	}
+	if monitoring := r.Spec.Monitoring; monitoring != nil {
+		if d := monitoring.NotReadyFor; d != nil && d.Duration < 0 {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "monitoring", "notReadyFor"), d.Duration.String(), "must not be negative"))
+		}
+		if d := monitoring.RestartWindow; d != nil && d.Duration < time.Second {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "monitoring", "restartWindow"), d.Duration.String(), "must be at least 1s"))
+		}
+	}
+	for i, toleration := range r.Spec.TemporaryTolerations {
+		path := field.NewPath("spec", "temporaryTolerations").Index(i)
+		if toleration.ExpiresAt.IsZero() {
+			errs = append(errs, field.Required(path.Child("expiresAt"), ""))
+		}
+		switch toleration.Operator {
+		case corev1.TolerationOpExists:
+			if toleration.Value != "" {
+				errs = append(errs, field.Invalid(path.Child("value"), toleration.Value, "must be empty when operator is Exists"))
+			}
+		case "", corev1.TolerationOpEqual:
+			if toleration.Key == "" {
+				errs = append(errs, field.Invalid(path.Child("operator"), toleration.Operator, "must be Exists when key is empty"))
+			}
+		default:
+			errs = append(errs, field.NotSupported(path.Child("operator"), toleration.Operator,
+				[]string{string(corev1.TolerationOpEqual), string(corev1.TolerationOpExists)}))
+		}
+		switch toleration.Effect {
+		case "", corev1.TaintEffectNoSchedule, corev1.TaintEffectPreferNoSchedule, corev1.TaintEffectNoExecute:
+		default:
+			errs = append(errs, field.NotSupported(path.Child("effect"), toleration.Effect,
+				[]string{string(corev1.TaintEffectNoSchedule), string(corev1.TaintEffectPreferNoSchedule), string(corev1.TaintEffectNoExecute)}))
+		}
+	}
+	if r.Spec.HealthPort == ServingPort {
+		errs = append(errs, field.Invalid(field.NewPath("spec", "healthPort"), r.Spec.HealthPort, fmt.Sprintf("must differ from the serving port %d", ServingPort)))
+	}
+	if r.Spec.PodSpecPatch != nil {
+		spec := &corev1.PodSpec{Containers: []corev1.Container{{Name: WebserverContainerName}}}
+		if err := ApplyPodSpecPatch(spec, r.Spec.PodSpecPatch); err != nil {
+			errs = append(errs, field.Invalid(field.NewPath("spec", "podSpecPatch"), string(r.Spec.PodSpecPatch.Raw), err.Error()))
+		}
+		errs = append(errs, r.validatePorts()...)
+	}
+	return errs
+}
+
+// serviceTypeAllowed reports whether AllowedServiceTypes permits t, where an
+// empty type is ClusterIP.
+func serviceTypeAllowed(t corev1.ServiceType) bool {
+	if len(AllowedServiceTypes) == 0 {
+		return true
+	}
+	if t == "" {
+		t = corev1.ServiceTypeClusterIP
+	}
+	for _, allowed := range AllowedServiceTypes {
+		if t == allowed {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// WebserverListPath is where the manager serves the list of Webservers when
+// the admin endpoint is enabled.
+const WebserverListPath = "/webservers"
+
+// WebserverList is the admin endpoint's response.
+type WebserverList struct {
+	Items []WebserverSummary `json:"items"`
+}
+
+// WebserverSummary describes one Webserver for the admin endpoint.
+type WebserverSummary struct {
+	Namespace string                         `json:"namespace"`
+	Name      string                         `json:"name"`
+	Phase     serversv1alpha1.WebserverPhase `json:"phase,omitempty"`
+
+	// Pods counts the Webserver's pods and ReadyPods the ready ones.
+	Pods      int `json:"pods"`
+	ReadyPods int `json:"readyPods"`
+
+	// URL is where the Route or Ingress serves the Webserver, if it has a
+	// host.
+	URL string `json:"url,omitempty"`
+}
+
+// NewWebserverListHandler returns a read-only handler that lists every
+// Webserver with its phase, pod counts and URL as JSON. It reads through
+// reader, normally the manager's cached client, so requests do not reach
+// the API server.
+func NewWebserverListHandler(reader client.Reader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		list, err := listWebservers(r.Context(), reader)
+		if err != nil {
+			log.FromContext(r.Context()).Error(err, "Listing Webservers for the admin endpoint")
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(list)
+	})
+}
+
+// listWebservers summarizes every Webserver, sorted by namespace and name.
+func listWebservers(ctx context.Context, reader client.Reader) (*WebserverList, error) {
+	webservers := &serversv1alpha1.WebserverList{}
+	if err := reader.List(ctx, webservers); err != nil {
+		return nil, err
+	}
+	list := &WebserverList{Items: []WebserverSummary{}}
+	for i := range webservers.Items {
+		instance := &webservers.Items[i]
+		summary := WebserverSummary{
+			Namespace: instance.Namespace,
+			Name:      instance.Name,
+			Phase:     instance.Status.Phase,
+		}
+		pods := &corev1.PodList{}
+		err := reader.List(ctx, pods,
+			client.InNamespace(targetNamespace(instance)),
+			client.MatchingLabels(labelsForWebserver(instance)))
+		if err != nil {
+			return nil, err
+		}
+		summary.Pods = len(pods.Items)
+		for j := range pods.Items {
+			if podReady(&pods.Items[j]) {
+				summary.ReadyPods++
+			}
+		}
+		if summary.URL, err = webserverURL(ctx, reader, instance); err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, summary)
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		a, b := list.Items[i], list.Items[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return list, nil
+}
+
+// webserverHost returns the host the Webserver is served at: its Route's
+// host, or the Ingress host when it is exposed through an Ingress.
+func webserverHost(instance *serversv1alpha1.Webserver) string {
+	if !enabled(instance.Spec.CreateRoute) {
+		return ""
+	}
+	if instance.Spec.ExposeVia == serversv1alpha1.ExposeViaIngress {
+		return instance.Spec.IngressHost
+	}
+	return instance.Status.Host
+}
+
+// webserverURL returns the URL the Webserver is served at, or "" when it
+// has no host. The scheme is https when its live Route or Ingress
+// terminates TLS for the host, and http otherwise.
+func webserverURL(ctx context.Context, reader client.Reader, instance *serversv1alpha1.Webserver) (string, error) {
+	host := webserverHost(instance)
+	if host == "" {
+		return "", nil
+	}
+	key := client.ObjectKey{Namespace: targetNamespace(instance), Name: routeName(instance)}
+	secure := false
+	switch instance.Spec.ExposeVia {
+	case serversv1alpha1.ExposeViaGateway:
+		// TLS is up to the Gateway's listener, which is not read here.
+	case serversv1alpha1.ExposeViaIngress:
+		ingress := &networkingv1.Ingress{}
+		err := reader.Get(ctx, key, ingress)
+		if err != nil && !errors.IsNotFound(err) {
+			return "", err
+		}
+		for _, tls := range ingress.Spec.TLS {
+			secure = secure || len(tls.Hosts) == 0
+			for _, tlsHost := range tls.Hosts {
+				secure = secure || tlsHost == host
+			}
+		}
+	default:
+		route := &routev1.Route{}
+		err := reader.Get(ctx, key, route)
+		if err != nil && !errors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			return "", err
+		}
+		secure = route.Spec.TLS != nil
+	}
+	if secure {
+		return "https://" + host, nil
+	}
+	return "http://" + host, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Admin endpoint", func() {
+	It("lists https URLs for Webservers whose Route terminates TLS", func() {
+		plain := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "plain", Namespace: "default"}}
+		plain.Status.Host = "plain.apps.example.com"
+		secure := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "secure", Namespace: "default"}}
+		secure.Status.Host = "secure.apps.example.com"
+		route := &routev1.Route{
+			ObjectMeta: metav1.ObjectMeta{Name: "secure", Namespace: "default"},
+			Spec:       routev1.RouteSpec{TLS: &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}},
+		}
+		r := newFakeReconciler(plain, secure, route)
+
+		list, err := listWebservers(context.Background(), r.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(list.Items).To(HaveLen(2))
+		Expect(list.Items[0].URL).To(Equal("http://plain.apps.example.com"))
+		Expect(list.Items[1].URL).To(Equal("https://secure.apps.example.com"))
+	})
+})
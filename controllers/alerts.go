@@ -0,0 +1,107 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// reconcileAlerts applies the Webserver's PrometheusRule, or deletes the one
+// it created earlier when monitoring is off. A missing PrometheusRule CRD
+// is reported in the PrometheusRuleApplied condition rather than failing the
+// reconcile, since the Webserver itself does not depend on it.
+func (r *WebserverReconciler) reconcileAlerts(ctx context.Context, instance *serversv1alpha1.Webserver, desired *unstructured.Unstructured, namespace string) error {
+	keep := ""
+	if desired != nil {
+		keep = desired.GetName()
+	}
+	rules := &unstructured.UnstructuredList{}
+	rules.SetGroupVersionKind(prometheusRuleGVK.GroupVersion().WithKind(prometheusRuleGVK.Kind + "List"))
+	if err := r.deleteOwnedExcept(ctx, instance, namespace, rules, keep); err != nil {
+		return err
+	}
+
+	if desired == nil {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionPrometheusRuleApplied)
+		instance.Status.Resources.PrometheusRule = serversv1alpha1.ResourceStatus{}
+		return nil
+	}
+	available, err := r.prometheusRuleAvailable()
+	if err == nil && !available {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionPrometheusRuleApplied,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: instance.Generation,
+			Reason:             "NotInstalled",
+			Message:            fmt.Sprintf("the %s PrometheusRule CRD is not installed", prometheusRuleGVK.GroupVersion()),
+		})
+		return nil
+	}
+	if err == nil {
+		err = r.reconcilePrometheusRule(ctx, instance, desired)
+	}
+	setAppliedCondition(instance, serversv1alpha1.ConditionPrometheusRuleApplied, err)
+	return err
+}
+
+// reconcilePrometheusRule creates or updates the Webserver's PrometheusRule
+// to match the desired one.
+func (r *WebserverReconciler) reconcilePrometheusRule(ctx context.Context, instance *serversv1alpha1.Webserver, desired *unstructured.Unstructured) error {
+	var rule *unstructured.Unstructured
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		rule = &unstructured.Unstructured{}
+		rule.SetGroupVersionKind(prometheusRuleGVK)
+		rule.SetName(desired.GetName())
+		rule.SetNamespace(desired.GetNamespace())
+		op, err = r.createOrUpdate(ctx, rule, func() error {
+			liveVersion = rule.GetResourceVersion()
+			rule.Object["spec"] = runtime.DeepCopyJSONValue(desired.Object["spec"])
+			return r.setOwner(instance, rule)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "PrometheusRule", desired.GetName(), liveVersion, rule.GetResourceVersion(), err)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled PrometheusRule", "prometheusRule", rule.GetName(), "operation", op)
+	recordApplied(&instance.Status.Resources.PrometheusRule, liveVersion, rule.GetResourceVersion())
+	return nil
+}
+
+// prometheusRuleAvailable reports whether the cluster serves the Prometheus
+// Operator's PrometheusRule.
+func (r *WebserverReconciler) prometheusRuleAvailable() (bool, error) {
+	_, err := r.Client.RESTMapper().RESTMapping(prometheusRuleGVK.GroupKind(), prometheusRuleGVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
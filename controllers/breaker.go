@@ -0,0 +1,111 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// circuitBreaker stops all reconciles for a while once the API server has
+// failed too many of them in a row, so a struggling control plane is not
+// hammered with retries from every Webserver at once.
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, cooldown: cooldown}
+}
+
+// wait returns how long reconciles must be held off while the breaker is
+// open, or zero if they may proceed.
+func (b *circuitBreaker) wait() time.Duration {
+	if b == nil || b.threshold <= 0 {
+		return 0
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d := time.Until(b.openUntil); d > 0 {
+		return d
+	}
+	circuitBreakerOpen.Set(0)
+	return 0
+}
+
+// record counts the outcome of a reconcile. A success, or a failure that is
+// not the API server's fault, closes the breaker. Once threshold API server
+// failures have happened in a row, each further one opens it for the
+// cooldown. It reports whether this outcome opened the breaker.
+func (b *circuitBreaker) record(err error) bool {
+	if b == nil || b.threshold <= 0 {
+		return false
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !apiServerError(err) {
+		b.failures = 0
+		return false
+	}
+	b.failures++
+	if b.failures < b.threshold {
+		return false
+	}
+	b.openUntil = time.Now().Add(b.cooldown)
+	circuitBreakerOpen.Set(1)
+	circuitBreakerTrips.Inc()
+	return true
+}
+
+// apiServerError reports whether err, or any error aggregated in it, means
+// the API server is unavailable or overloaded.
+func apiServerError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var agg utilerrors.Aggregate
+	if errors.As(err, &agg) {
+		for _, e := range agg.Errors() {
+			if apiServerError(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var netErr net.Error
+	return apierrors.IsServerTimeout(err) ||
+		apierrors.IsTimeout(err) ||
+		apierrors.IsTooManyRequests(err) ||
+		apierrors.IsInternalError(err) ||
+		apierrors.IsServiceUnavailable(err) ||
+		apierrors.IsUnexpectedServerError(err) ||
+		errors.As(err, &netErr)
+}
@@ -0,0 +1,1077 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// httpPortName names the webserver's HTTP port on both the container and
+	// the Service, so a Route can target it by name.
+	httpPortName = serversv1alpha1.ServingPortName
+
+	// topologyModeAnnotation enables topology aware routing on a Service.
+	topologyModeAnnotation = "service.kubernetes.io/topology-mode"
+
+	// webserverContainerName names the httpd container in the pod template.
+	webserverContainerName = serversv1alpha1.WebserverContainerName
+
+	// templateHashAnnotation records on the Deployment or DaemonSet a hash
+	// of the pod template the operator last wrote.
+	templateHashAnnotation = "servers.redhat.com/template-hash"
+
+	// routeTimeoutAnnotation sets the OpenShift router's server timeout for
+	// a Route.
+	routeTimeoutAnnotation = "haproxy.router.openshift.io/timeout"
+
+	// changeCauseAnnotation on a Deployment is copied to the ReplicaSet of
+	// each new revision and shown by kubectl rollout history.
+	changeCauseAnnotation = "kubernetes.io/change-cause"
+
+	// healthPortName names the container port the probes target when the
+	// Webserver sets a HealthPort.
+	healthPortName = serversv1alpha1.HealthPortName
+
+	// httpPort is the port httpd listens on.
+	httpPort = serversv1alpha1.ServingPort
+
+	// httpdConfDir is the directory httpd reads httpd.conf from in the
+	// webserver image.
+	httpdConfDir = serversv1alpha1.HttpdConfDir
+
+	// configVolumeName names the volume holding the ConfigConfigMap.
+	configVolumeName = "httpd-config"
+
+	// httpdTLSDir is the directory the TLS Secret is mounted at.
+	httpdTLSDir = serversv1alpha1.HttpdTLSDir
+
+	// tlsVolumeName names the volume holding the TLS Secret.
+	tlsVolumeName = "tls"
+
+	// httpdDataDir is the httpd document root, where a StatefulSet's
+	// per-pod storage is mounted.
+	httpdDataDir = serversv1alpha1.HttpdDataDir
+
+	// dataVolumeName names the StatefulSet's volume claim template.
+	dataVolumeName = "data"
+
+	// serviceAccountTokenVolumeName names the volume holding the projected
+	// ServiceAccount token.
+	serviceAccountTokenVolumeName = "service-account-token"
+
+	// defaultServiceAccountTokenPath is where the projected ServiceAccount
+	// token is written when ServiceAccountToken does not set a path.
+	defaultServiceAccountTokenPath = serversv1alpha1.DefaultServiceAccountTokenPath
+)
+
+// manifests holds the objects the operator manages for a Webserver.
+type manifests struct {
+	Deployment     *appsv1.Deployment
+	DaemonSet      *appsv1.DaemonSet
+	StatefulSet    *appsv1.StatefulSet
+	Services       []*corev1.Service
+	Route          *routev1.Route
+	HTTPRoute      *unstructured.Unstructured
+	Ingress        *networkingv1.Ingress
+	ConfigMaps     []*corev1.ConfigMap
+	PrometheusRule *unstructured.Unstructured
+
+	// Extra holds the objects added by the reconciler's ResourceBuilders.
+	Extra []*unstructured.Unstructured
+
+	// RouteHeld is set when the Route is left out because its recreate
+	// delay has not passed, rather than because it is not wanted.
+	RouteHeld bool
+}
+
+// copyPodTemplate gives the DaemonSet or StatefulSet the Deployment's pod
+// template, and the StatefulSet its replicas. The steps after rendering
+// fill in the Deployment's, which a DaemonSet or StatefulSet runs as is.
+func (m *manifests) copyPodTemplate() {
+	if m.DaemonSet != nil {
+		m.DaemonSet.Spec.Template = m.Deployment.Spec.Template
+	}
+	if m.StatefulSet != nil {
+		m.StatefulSet.Spec.Template = m.Deployment.Spec.Template
+		m.StatefulSet.Spec.Replicas = m.Deployment.Spec.Replicas
+	}
+}
+
+// objects returns the rendered objects, skipping any that are disabled.
+// With a DaemonSet or StatefulSet, the Deployment only carries the pod
+// template and is left out.
+func (m *manifests) objects() []client.Object {
+	objs := []client.Object{m.Deployment}
+	if m.DaemonSet != nil {
+		objs = []client.Object{m.DaemonSet}
+	}
+	if m.StatefulSet != nil {
+		objs = []client.Object{m.StatefulSet}
+	}
+	for _, service := range m.Services {
+		objs = append(objs, service)
+	}
+	if m.Route != nil {
+		objs = append(objs, m.Route)
+	}
+	if m.HTTPRoute != nil {
+		objs = append(objs, m.HTTPRoute)
+	}
+	if m.Ingress != nil {
+		objs = append(objs, m.Ingress)
+	}
+	for _, configMap := range m.ConfigMaps {
+		objs = append(objs, configMap)
+	}
+	if m.PrometheusRule != nil {
+		objs = append(objs, m.PrometheusRule)
+	}
+	for _, obj := range m.Extra {
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// DefaultImage is the httpd image used when a Webserver does not set one.
+// The manager overrides it at startup from --default-image or the
+// DEFAULT_WEBSERVER_IMAGE environment variable.
+var DefaultImage = "registry.access.redhat.com/rhscl/httpd-24-rhel7:latest"
+
+// RenderManifests returns the Deployment, DaemonSet or StatefulSet,
+// Services, Route, HTTPRoute or Ingress, ConfigMaps and PrometheusRule the
+// operator would create for a Webserver, without contacting the cluster,
+// followed by the objects builders add. The steps of a reconcile that read
+// the cluster, such as the config checksums, are left out. The builders run as they do in
+// the reconciler, with a DefaultResourceBuilder first unless they include
+// one. Owner references are only added when the objects are applied.
+func RenderManifests(instance *serversv1alpha1.Webserver, builders ...ResourceBuilder) ([]client.Object, error) {
+	m, extra, err := runBuilders(instance, builders, DefaultFieldManager, func() (*manifests, error) {
+		return previewManifests(instance)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(m.objects(), extra...), nil
+}
+
+// previewManifests renders the built-in objects for RenderManifests. It
+// takes the reconciler's steps that need no cluster, in the same order.
+// The rest are left out: the config and Secret checksums, injected
+// sidecars, the base pod template and the default image pinned in status.
+func previewManifests(instance *serversv1alpha1.Webserver) (*manifests, error) {
+	m, err := renderManifests(instance, DefaultFieldManager)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if _, err := applyScaleSchedule(instance, m.Deployment, now); err != nil {
+		return nil, err
+	}
+	applySpreadAcrossNodes(instance, &m.Deployment.Spec.Template)
+	applyTemporaryTolerations(instance, &m.Deployment.Spec.Template, now)
+	m.copyPodTemplate()
+	return m, nil
+}
+
+// renderManifests builds the desired state of every object the Webserver
+// manages, labelled as written by fieldManager. Objects the Webserver
+// disables or does not expose through are left nil.
+func renderManifests(instance *serversv1alpha1.Webserver, fieldManager string) (*manifests, error) {
+	namespace := targetNamespace(instance)
+	m := &manifests{
+		Deployment: deploymentForWebserver(instance, namespace),
+	}
+	if err := serversv1alpha1.ApplyPodSpecPatch(&m.Deployment.Spec.Template.Spec, instance.Spec.PodSpecPatch); err != nil {
+		return nil, err
+	}
+	switch instance.Spec.WorkloadType {
+	case serversv1alpha1.WorkloadDaemonSet:
+		m.DaemonSet = daemonSetForWebserver(m.Deployment)
+	case serversv1alpha1.WorkloadStatefulSet:
+		m.StatefulSet = statefulSetForWebserver(instance, m.Deployment)
+	}
+	if enabled(instance.Spec.CreateService) {
+		for _, spec := range serviceSpecs(instance) {
+			m.Services = append(m.Services, serviceForWebserver(instance, namespace, spec))
+		}
+	}
+	// A StatefulSet needs its headless Service even without the others.
+	if m.StatefulSet != nil {
+		m.Services = append(m.Services, headlessServiceForWebserver(instance, namespace))
+	}
+	if enabled(instance.Spec.CreateRoute) {
+		switch instance.Spec.ExposeVia {
+		case serversv1alpha1.ExposeViaGateway:
+			route, err := httpRouteForWebserver(instance, namespace)
+			if err != nil {
+				return nil, err
+			}
+			m.HTTPRoute = route
+		case serversv1alpha1.ExposeViaIngress:
+			m.Ingress = ingressForWebserver(instance, namespace)
+		default:
+			m.Route = routeForWebserver(instance, namespace)
+		}
+	}
+	for _, spec := range instance.Spec.ExtraConfigMaps {
+		m.ConfigMaps = append(m.ConfigMaps, configMapForWebserver(namespace, spec))
+	}
+	if instance.Spec.Monitoring != nil {
+		m.PrometheusRule = prometheusRuleForWebserver(instance, namespace)
+	}
+	for _, obj := range m.objects() {
+		addOwnerLabels(instance, obj, fieldManager)
+	}
+	return m, nil
+}
+
+// enabled reports the value of an optional switch that defaults to true.
+func enabled(b *bool) bool {
+	return b == nil || *b
+}
+
+// labelsForWebserver returns the labels that select the Webserver's pods.
+func labelsForWebserver(instance *serversv1alpha1.Webserver) map[string]string {
+	return instance.PodSelector()
+}
+
+// podLabels returns the labels of the Webserver's pods: the selector labels
+// plus PodLabels, which cannot override them.
+func podLabels(instance *serversv1alpha1.Webserver) map[string]string {
+	labels := labelsForWebserver(instance)
+	for k, v := range instance.Spec.PodLabels {
+		if _, ok := labels[k]; !ok {
+			labels[k] = v
+		}
+	}
+	return labels
+}
+
+// deploymentLabels returns the labels for the Deployment's own metadata.
+// They are never copied to the pod template, so changing them neither
+// touches the selector nor rolls the pods.
+func deploymentLabels(instance *serversv1alpha1.Webserver) map[string]string {
+	labels := map[string]string{}
+	for k, v := range instance.Spec.DeploymentLabels {
+		labels[k] = v
+	}
+	return labels
+}
+
+// deploymentForWebserver returns the Deployment running the Webserver's pods.
+func deploymentForWebserver(instance *serversv1alpha1.Webserver, namespace string) *appsv1.Deployment {
+	replicas := int32(1)
+	if instance.Spec.Count != nil {
+		replicas = *instance.Spec.Count
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name,
+			Namespace: namespace,
+			Labels:    deploymentLabels(instance),
+		},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Paused:   instance.Spec.PauseRollout,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: labelsForWebserver(instance),
+			},
+			Strategy:                strategyForWebserver(instance),
+			Template:                podTemplateForWebserver(instance),
+			ProgressDeadlineSeconds: progressDeadlineSeconds(instance),
+		},
+	}
+	if cause := changeCause(instance); cause != "" {
+		deployment.Annotations = map[string]string{changeCauseAnnotation: cause}
+	}
+	return deployment
+}
+
+// daemonSetForWebserver returns the DaemonSet running the pods of deployment,
+// the Webserver's rendered Deployment, one per node.
+func daemonSetForWebserver(deployment *appsv1.Deployment) *appsv1.DaemonSet {
+	return &appsv1.DaemonSet{
+		ObjectMeta: *deployment.ObjectMeta.DeepCopy(),
+		Spec: appsv1.DaemonSetSpec{
+			Selector: deployment.Spec.Selector.DeepCopy(),
+			Template: *deployment.Spec.Template.DeepCopy(),
+		},
+	}
+}
+
+// statefulSetForWebserver returns the StatefulSet running the pods of
+// deployment, the Webserver's rendered Deployment, with stable identities
+// from the headless Service and, with Storage, a claim per pod.
+func statefulSetForWebserver(instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) *appsv1.StatefulSet {
+	statefulSet := &appsv1.StatefulSet{
+		ObjectMeta: *deployment.ObjectMeta.DeepCopy(),
+		Spec: appsv1.StatefulSetSpec{
+			Replicas:    deployment.Spec.Replicas,
+			Selector:    deployment.Spec.Selector.DeepCopy(),
+			Template:    *deployment.Spec.Template.DeepCopy(),
+			ServiceName: instance.Name + serversv1alpha1.HeadlessServiceSuffix,
+		},
+	}
+	if storage := instance.Spec.Storage; storage != nil {
+		modes := storage.AccessModes
+		if len(modes) == 0 {
+			modes = []corev1.PersistentVolumeAccessMode{corev1.ReadWriteOnce}
+		}
+		statefulSet.Spec.VolumeClaimTemplates = []corev1.PersistentVolumeClaim{{
+			ObjectMeta: metav1.ObjectMeta{Name: dataVolumeName},
+			Spec: corev1.PersistentVolumeClaimSpec{
+				AccessModes:      modes,
+				StorageClassName: storage.StorageClassName,
+				Resources: corev1.ResourceRequirements{
+					Requests: corev1.ResourceList{corev1.ResourceStorage: storage.Size},
+				},
+			},
+		}}
+	}
+	return statefulSet
+}
+
+// changeCause returns the reason recorded in the Deployment's rollout
+// history: Spec.ChangeReason, or else the Webserver's own change-cause
+// annotation.
+func changeCause(instance *serversv1alpha1.Webserver) string {
+	if instance.Spec.ChangeReason != "" {
+		return instance.Spec.ChangeReason
+	}
+	return instance.Annotations[changeCauseAnnotation]
+}
+
+// strategyForWebserver returns the Deployment's rolling update strategy.
+// The Kubernetes defaults are spelled out so the live Deployment matches;
+// with ZeroDowntime no ready pod is removed before its replacement is ready.
+func strategyForWebserver(instance *serversv1alpha1.Webserver) appsv1.DeploymentStrategy {
+	maxUnavailable := intstr.FromString("25%")
+	maxSurge := intstr.FromString("25%")
+	if instance.Spec.ZeroDowntime {
+		maxUnavailable = intstr.FromInt(0)
+	}
+	return appsv1.DeploymentStrategy{
+		Type: appsv1.RollingUpdateDeploymentStrategyType,
+		RollingUpdate: &appsv1.RollingUpdateDeployment{
+			MaxUnavailable: &maxUnavailable,
+			MaxSurge:       &maxSurge,
+		},
+	}
+}
+
+// podAnnotations returns the annotations for the pod template. They are not
+// applied to the Deployment itself.
+func podAnnotations(instance *serversv1alpha1.Webserver) map[string]string {
+	if len(instance.Spec.PodAnnotations) == 0 {
+		return nil
+	}
+	annotations := map[string]string{}
+	for k, v := range instance.Spec.PodAnnotations {
+		annotations[k] = v
+	}
+	return annotations
+}
+
+// podTemplateForWebserver returns the pod template for the Webserver's
+// Deployment. Its labels are the selector labels plus PodLabels.
+func podTemplateForWebserver(instance *serversv1alpha1.Webserver) corev1.PodTemplateSpec {
+	template := corev1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:      podLabels(instance),
+			Annotations: podAnnotations(instance),
+		},
+		Spec: corev1.PodSpec{
+			RuntimeClassName:             instance.Spec.RuntimeClassName,
+			Overhead:                     instance.Spec.Overhead,
+			ShareProcessNamespace:        instance.Spec.ShareProcessNamespace,
+			ReadinessGates:               instance.Spec.ReadinessGates,
+			AutomountServiceAccountToken: instance.Spec.AutomountServiceAccountToken,
+			Containers: []corev1.Container{
+				{
+					Name:                     webserverContainerName,
+					Image:                    imageForWebserver(instance),
+					WorkingDir:               instance.Spec.WorkingDir,
+					SecurityContext:          instance.Spec.SecurityContext,
+					Env:                      envForWebserver(instance),
+					Resources:                resourcesForWebserver(instance),
+					Ports:                    instance.ContainerPorts(),
+					LivenessProbe:            livenessProbeForWebserver(instance),
+					ReadinessProbe:           readinessProbeForWebserver(instance),
+					TerminationMessagePath:   instance.Spec.TerminationMessagePath,
+					TerminationMessagePolicy: terminationMessagePolicy(instance),
+				},
+			},
+		},
+	}
+	template.Spec.Containers = append(template.Spec.Containers, instance.Spec.Sidecars...)
+	if instance.Spec.ZeroDowntime {
+		drain := drainSeconds(instance)
+		template.Spec.Containers[0].Lifecycle = &corev1.Lifecycle{
+			PreStop: &corev1.Handler{
+				Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", fmt.Sprintf("sleep %d", drain)}},
+			},
+		}
+		// The preStop sleep counts against the grace period, so leave httpd
+		// the usual 30 seconds to shut down after it.
+		grace := int64(drain) + 30
+		template.Spec.TerminationGracePeriodSeconds = &grace
+	}
+	if name := instance.Spec.ConfigConfigMap; name != "" {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: configVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: name},
+				},
+			},
+		})
+		container := &template.Spec.Containers[0]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      configVolumeName,
+			MountPath: httpdConfDir,
+			ReadOnly:  true,
+		})
+	}
+	if instance.Spec.Storage != nil && instance.Spec.WorkloadType == serversv1alpha1.WorkloadStatefulSet {
+		container := &template.Spec.Containers[0]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      dataVolumeName,
+			MountPath: httpdDataDir,
+		})
+	}
+	if tls := instance.Spec.TLS; tls != nil {
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: tlsVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: tls.SecretName},
+			},
+		})
+		container := &template.Spec.Containers[0]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      tlsVolumeName,
+			MountPath: httpdTLSDir,
+			ReadOnly:  true,
+		})
+	}
+	if token := instance.Spec.ServiceAccountToken; token != nil {
+		path := token.Path
+		if path == "" {
+			path = defaultServiceAccountTokenPath
+		}
+		template.Spec.Volumes = append(template.Spec.Volumes, corev1.Volume{
+			Name: serviceAccountTokenVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Projected: &corev1.ProjectedVolumeSource{
+					Sources: []corev1.VolumeProjection{{
+						ServiceAccountToken: &corev1.ServiceAccountTokenProjection{
+							Audience:          token.Audience,
+							ExpirationSeconds: token.ExpirationSeconds,
+							Path:              filepath.Base(path),
+						},
+					}},
+				},
+			},
+		})
+		container := &template.Spec.Containers[0]
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      serviceAccountTokenVolumeName,
+			MountPath: filepath.Dir(path),
+			ReadOnly:  true,
+		})
+	}
+	return template
+}
+
+// imageForWebserver returns the httpd image for the Webserver's pods,
+// rewritten to pull from a registry mirror if one is configured.
+func imageForWebserver(instance *serversv1alpha1.Webserver) string {
+	image, _ := mirrorImage(sourceImage(instance))
+	return image
+}
+
+// sourceImage returns the httpd image the Webserver asks for, before any
+// mirror rewrite.
+func sourceImage(instance *serversv1alpha1.Webserver) string {
+	if instance.Spec.Image != "" {
+		return instance.Spec.Image
+	}
+	return DefaultImage
+}
+
+// envForWebserver returns the webserver container's environment: the
+// variables derived from the Httpd settings, followed by Env so that its
+// entries take precedence.
+func envForWebserver(instance *serversv1alpha1.Webserver) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	if httpd := instance.Spec.Httpd; httpd != nil {
+		if httpd.MPM != "" {
+			env = append(env, corev1.EnvVar{Name: "HTTPD_MPM", Value: httpd.MPM})
+		}
+		if httpd.MaxRequestWorkers > 0 {
+			env = append(env, corev1.EnvVar{Name: "HTTPD_MAX_REQUEST_WORKERS", Value: strconv.Itoa(int(httpd.MaxRequestWorkers))})
+		}
+		if httpd.StartServers > 0 {
+			env = append(env, corev1.EnvVar{Name: "HTTPD_START_SERVERS", Value: strconv.Itoa(int(httpd.StartServers))})
+		}
+	}
+	return append(env, instance.Spec.Env...)
+}
+
+// terminationMessagePolicy returns the webserver container's termination
+// message policy, FallbackToLogsOnError unless the Webserver sets one.
+func terminationMessagePolicy(instance *serversv1alpha1.Webserver) corev1.TerminationMessagePolicy {
+	if instance.Spec.TerminationMessagePolicy != "" {
+		return instance.Spec.TerminationMessagePolicy
+	}
+	return corev1.TerminationMessageFallbackToLogsOnError
+}
+
+// probeForWebserver returns an HTTP GET probe against the http port, or nil
+// when the Webserver does not request probes.
+func probeForWebserver(instance *serversv1alpha1.Webserver) *corev1.Probe {
+	if instance.Spec.ProbeScheme == "" && instance.Spec.HealthPort == 0 {
+		return nil
+	}
+	port, scheme := httpPortName, instance.Spec.ProbeScheme
+	if instance.Spec.HealthPort != 0 {
+		port = healthPortName
+	}
+	if scheme == "" {
+		scheme = corev1.URISchemeHTTP
+	}
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			HTTPGet: &corev1.HTTPGetAction{
+				Path:   "/",
+				Port:   intstr.FromString(port),
+				Scheme: scheme,
+			},
+		},
+	}
+}
+
+// livenessProbeForWebserver returns the liveness probe with the Webserver's
+// ProbeTiming applied. With a MemoryLivenessLimit it is a command that also
+// checks the container's memory.
+func livenessProbeForWebserver(instance *serversv1alpha1.Webserver) *corev1.Probe {
+	probe := probeForWebserver(instance)
+	if limit := instance.Spec.MemoryLivenessLimit; limit != nil {
+		probe = memoryLivenessProbe(instance, probe, limit.Value())
+	}
+	if probe != nil && instance.Spec.ProbeTiming != nil {
+		timing := instance.Spec.ProbeTiming
+		probe.PeriodSeconds = timing.PeriodSeconds
+		probe.TimeoutSeconds = timing.TimeoutSeconds
+		probe.FailureThreshold = timing.FailureThreshold
+	}
+	return probe
+}
+
+// memoryCheckCommand fails when the container's resident memory exceeds the
+// limit it is formatted with. It reads the anonymous memory from the cgroup
+// v2 memory.stat, or total_rss from the cgroup v1 one, and passes when
+// neither can be read.
+const memoryCheckCommand = `rss=$(cat /sys/fs/cgroup/memory.stat /sys/fs/cgroup/memory/memory.stat 2>/dev/null | ` +
+	`awk '$1 == "anon" || $1 == "total_rss" { print $2; exit }'); [ "${rss:-0}" -le %d ]`
+
+// memoryLivenessProbe returns an exec probe that fails when the container's
+// resident memory exceeds limit bytes, or when httpProbe, if any, would
+// fail.
+func memoryLivenessProbe(instance *serversv1alpha1.Webserver, httpProbe *corev1.Probe, limit int64) *corev1.Probe {
+	command := fmt.Sprintf(memoryCheckCommand, limit)
+	if httpProbe != nil {
+		port := int32(httpPort)
+		if instance.Spec.HealthPort != 0 {
+			port = instance.Spec.HealthPort
+		}
+		get := httpProbe.HTTPGet
+		insecure := ""
+		if get.Scheme == corev1.URISchemeHTTPS {
+			// Like the kubelet's HTTPS probes, do not verify the
+			// certificate.
+			insecure = "--insecure "
+		}
+		command += fmt.Sprintf(" && curl --fail --silent --output /dev/null %s%s://localhost:%d%s",
+			insecure, strings.ToLower(string(get.Scheme)), port, get.Path)
+	}
+	return &corev1.Probe{
+		Handler: corev1.Handler{
+			Exec: &corev1.ExecAction{Command: []string{"/bin/sh", "-c", command}},
+		},
+	}
+}
+
+// readinessProbeForWebserver returns the readiness probe with the
+// Webserver's ProbeTiming applied. With ZeroDowntime and no HTTP probes
+// configured, a TCP check on the http port keeps pods out of the endpoints
+// until httpd is listening.
+func readinessProbeForWebserver(instance *serversv1alpha1.Webserver) *corev1.Probe {
+	probe := probeForWebserver(instance)
+	if probe == nil {
+		if !instance.Spec.ZeroDowntime {
+			return nil
+		}
+		probe = &corev1.Probe{
+			Handler: corev1.Handler{
+				TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromString(httpPortName)},
+			},
+			PeriodSeconds: 5,
+		}
+	}
+	if timing := instance.Spec.ProbeTiming; timing != nil {
+		if timing.PeriodSeconds != 0 {
+			probe.PeriodSeconds = timing.PeriodSeconds
+		}
+		probe.TimeoutSeconds = timing.TimeoutSeconds
+		probe.FailureThreshold = timing.FailureThreshold
+		probe.SuccessThreshold = timing.SuccessThreshold
+	}
+	return probe
+}
+
+// drainSeconds returns how long a stopping pod keeps serving with
+// ZeroDowntime.
+func drainSeconds(instance *serversv1alpha1.Webserver) int32 {
+	if instance.Spec.DrainSeconds > 0 {
+		return instance.Spec.DrainSeconds
+	}
+	return 15
+}
+
+// progressDeadlineSeconds returns the Deployment's progress deadline. The
+// API server's default is written out so that unsetting it restores the
+// default.
+func progressDeadlineSeconds(instance *serversv1alpha1.Webserver) *int32 {
+	seconds := int32(600)
+	if instance.Spec.ProgressDeadlineSeconds != nil {
+		seconds = *instance.Spec.ProgressDeadlineSeconds
+	}
+	return &seconds
+}
+
+// serviceSpecs returns the Webserver's Services with defaults applied. A
+// Webserver that lists none gets a ClusterIP Service named after it.
+func serviceSpecs(instance *serversv1alpha1.Webserver) []serversv1alpha1.ServiceSpec {
+	name := instance.Name
+	if instance.Spec.ServiceName != "" {
+		name = instance.Spec.ServiceName
+	}
+	specs := []serversv1alpha1.ServiceSpec{{Name: name}}
+	if len(instance.Spec.Services) > 0 {
+		specs = make([]serversv1alpha1.ServiceSpec, len(instance.Spec.Services))
+		copy(specs, instance.Spec.Services)
+	}
+	for i := range specs {
+		if specs[i].Type == "" {
+			specs[i].Type = corev1.ServiceTypeClusterIP
+		}
+		if specs[i].Port == 0 {
+			specs[i].Port = httpPort
+		}
+		if specs[i].Protocol == "" {
+			specs[i].Protocol = corev1.ProtocolTCP
+		}
+	}
+	return specs
+}
+
+// routeServiceSpec returns the Service the Route or HTTPRoute targets.
+func routeServiceSpec(instance *serversv1alpha1.Webserver) serversv1alpha1.ServiceSpec {
+	specs := serviceSpecs(instance)
+	for _, spec := range specs {
+		if spec.Name == instance.Spec.RouteService {
+			return spec
+		}
+	}
+	return specs[0]
+}
+
+// serviceForWebserver returns a Service exposing the Webserver's pods.
+func serviceForWebserver(instance *serversv1alpha1.Webserver, namespace string, spec serversv1alpha1.ServiceSpec) *corev1.Service {
+	service := &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     spec.Type,
+			Selector:                 labelsForWebserver(instance),
+			PublishNotReadyAddresses: instance.Spec.PublishNotReadyAddresses,
+			Ports: []corev1.ServicePort{
+				{
+					Name:        httpPortName,
+					Protocol:    spec.Protocol,
+					AppProtocol: appProtocolForWebserver(instance, spec),
+					Port:        spec.Port,
+					TargetPort:  intstr.FromInt(httpPort),
+				},
+			},
+		},
+	}
+	if spec.Protocol != corev1.ProtocolTCP {
+		// The application protocol only describes the HTTP port.
+		service.Spec.Ports[0].AppProtocol = nil
+	}
+	if instance.Spec.TopologyAwareRouting {
+		service.Annotations = map[string]string{topologyModeAnnotation: "Auto"}
+	}
+	return service
+}
+
+// configMapForWebserver returns one of the Webserver's ExtraConfigMaps.
+func configMapForWebserver(namespace string, spec serversv1alpha1.InlineConfigMap) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      spec.Name,
+			Namespace: namespace,
+		},
+		Data: spec.Data,
+	}
+}
+
+// headlessServiceForWebserver returns the headless Service that gives a
+// StatefulSet's pods their DNS entries. Pods are listed before they are
+// ready, so peers can find each other while starting.
+func headlessServiceForWebserver(instance *serversv1alpha1.Webserver, namespace string) *corev1.Service {
+	return &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      instance.Name + serversv1alpha1.HeadlessServiceSuffix,
+			Namespace: namespace,
+		},
+		Spec: corev1.ServiceSpec{
+			Type:                     corev1.ServiceTypeClusterIP,
+			ClusterIP:                corev1.ClusterIPNone,
+			Selector:                 labelsForWebserver(instance),
+			PublishNotReadyAddresses: true,
+			Ports: []corev1.ServicePort{
+				{
+					Name:        httpPortName,
+					Protocol:    "TCP",
+					AppProtocol: appProtocolForWebserver(instance, serversv1alpha1.ServiceSpec{}),
+					Port:        httpPort,
+					TargetPort:  intstr.FromInt(httpPort),
+				},
+			},
+		},
+	}
+}
+
+// appProtocolForWebserver returns the appProtocol of the http port of the
+// Service spec describes: its own, or else the Webserver's.
+func appProtocolForWebserver(instance *serversv1alpha1.Webserver, spec serversv1alpha1.ServiceSpec) *string {
+	appProtocol := spec.AppProtocol
+	if appProtocol == "" {
+		appProtocol = instance.Spec.AppProtocol
+	}
+	if appProtocol == "" {
+		appProtocol = "http"
+	}
+	return &appProtocol
+}
+
+// routeForWebserver returns the Route exposing the Webserver's route Service.
+func routeForWebserver(instance *serversv1alpha1.Webserver, namespace string) *routev1.Route {
+	targetPort := intstr.FromInt(httpPort)
+	if instance.Spec.RouteTargetsPortName {
+		targetPort = intstr.FromString(httpPortName)
+	}
+
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      routeName(instance),
+			Namespace: namespace,
+			Labels:    labelsForWebserver(instance),
+		},
+		Spec: routev1.RouteSpec{
+			To: routev1.RouteTargetReference{
+				Kind: "Service",
+				Name: routeServiceSpec(instance).Name,
+			},
+			Port: &routev1.RoutePort{
+				TargetPort: targetPort,
+			},
+		},
+	}
+	if timeout := instance.Spec.RouteTimeout; timeout != nil {
+		route.Annotations = map[string]string{routeTimeoutAnnotation: routeTimeout(timeout.Duration)}
+	}
+	return route
+}
+
+// routeTimeout formats d for the router's timeout annotation, which takes
+// an integer with a unit rather than a Go duration.
+func routeTimeout(d time.Duration) string {
+	if d%time.Second == 0 {
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+	return fmt.Sprintf("%dms", d/time.Millisecond)
+}
+
+// httpRouteGVK identifies the Gateway API HTTPRoute. It is handled as an
+// unstructured object so the operator does not depend on the Gateway API
+// types or require its CRDs to be installed.
+var httpRouteGVK = schema.GroupVersionKind{
+	Group:   "gateway.networking.k8s.io",
+	Version: "v1",
+	Kind:    "HTTPRoute",
+}
+
+// httpRouteForWebserver returns the HTTPRoute exposing the Webserver's
+// Service through the configured Gateway.
+func httpRouteForWebserver(instance *serversv1alpha1.Webserver, namespace string) (*unstructured.Unstructured, error) {
+	gateway := instance.Spec.Gateway
+	if gateway == nil || gateway.ParentName == "" {
+		return nil, errors.New("exposeVia Gateway requires spec.gateway.parentName")
+	}
+
+	parent := map[string]interface{}{"name": gateway.ParentName}
+	if gateway.ParentNamespace != "" {
+		parent["namespace"] = gateway.ParentNamespace
+	}
+	if gateway.SectionName != "" {
+		parent["sectionName"] = gateway.SectionName
+	}
+	path := gateway.Path
+	if path == "" {
+		path = "/"
+	}
+	service := routeServiceSpec(instance)
+
+	spec := map[string]interface{}{
+		"parentRefs": []interface{}{parent},
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{"type": "PathPrefix", "value": path},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{"name": service.Name, "port": int64(service.Port)},
+				},
+			},
+		},
+	}
+	if gateway.Hostname != "" {
+		spec["hostnames"] = []interface{}{gateway.Hostname}
+	}
+
+	route := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	route.SetGroupVersionKind(httpRouteGVK)
+	route.SetName(routeName(instance))
+	route.SetNamespace(namespace)
+	route.SetLabels(labelsForWebserver(instance))
+	return route, nil
+}
+
+// applyTemporaryTolerations adds the Webserver's TemporaryTolerations that
+// have not expired at now to template, and returns how long until the next
+// of them expires, or zero if none are left.
+func applyTemporaryTolerations(instance *serversv1alpha1.Webserver, template *corev1.PodTemplateSpec, now time.Time) time.Duration {
+	var next time.Duration
+	for _, toleration := range instance.Spec.TemporaryTolerations {
+		left := toleration.ExpiresAt.Sub(now)
+		if left <= 0 {
+			continue
+		}
+		template.Spec.Tolerations = append(template.Spec.Tolerations, toleration.Toleration)
+		if next == 0 || left < next {
+			next = left
+		}
+	}
+	return next
+}
+
+// applySpreadAcrossNodes adds to template a preferred anti-affinity
+// between the Webserver's pods on the hostname topology key when
+// SpreadAcrossNodes is set, keeping any affinity the template already has.
+func applySpreadAcrossNodes(instance *serversv1alpha1.Webserver, template *corev1.PodTemplateSpec) {
+	if !instance.Spec.SpreadAcrossNodes {
+		return
+	}
+	spec := &template.Spec
+	if spec.Affinity == nil {
+		spec.Affinity = &corev1.Affinity{}
+	}
+	if spec.Affinity.PodAntiAffinity == nil {
+		spec.Affinity.PodAntiAffinity = &corev1.PodAntiAffinity{}
+	}
+	antiAffinity := spec.Affinity.PodAntiAffinity
+	antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution = append(antiAffinity.PreferredDuringSchedulingIgnoredDuringExecution,
+		corev1.WeightedPodAffinityTerm{
+			Weight: 100,
+			PodAffinityTerm: corev1.PodAffinityTerm{
+				LabelSelector: &metav1.LabelSelector{MatchLabels: labelsForWebserver(instance)},
+				TopologyKey:   corev1.LabelHostname,
+			},
+		})
+}
+
+// prometheusRuleGVK identifies the Prometheus Operator's PrometheusRule,
+// handled as an unstructured object like the HTTPRoute.
+var prometheusRuleGVK = schema.GroupVersionKind{
+	Group:   "monitoring.coreos.com",
+	Version: "v1",
+	Kind:    "PrometheusRule",
+}
+
+const (
+	// defaultNotReadyFor, defaultRestartThreshold and defaultRestartWindow
+	// are the alert thresholds of a WebserverMonitoring that leaves them
+	// unset.
+	defaultNotReadyFor      = 10 * time.Minute
+	defaultRestartThreshold = 5
+	defaultRestartWindow    = 15 * time.Minute
+)
+
+// prometheusRuleForWebserver returns the PrometheusRule of the Webserver's
+// default alerts, on the webserver_ready and webserver_container_restarts
+// metrics the operator exports.
+func prometheusRuleForWebserver(instance *serversv1alpha1.Webserver, namespace string) *unstructured.Unstructured {
+	monitoring := instance.Spec.Monitoring
+	notReadyFor := defaultNotReadyFor
+	if monitoring.NotReadyFor != nil {
+		notReadyFor = monitoring.NotReadyFor.Duration
+	}
+	threshold := int32(defaultRestartThreshold)
+	if monitoring.RestartThreshold > 0 {
+		threshold = monitoring.RestartThreshold
+	}
+	window := defaultRestartWindow
+	if monitoring.RestartWindow != nil {
+		window = monitoring.RestartWindow.Duration
+	}
+
+	selector := fmt.Sprintf(`namespace=%q,webserver=%q`, instance.Namespace, instance.Name)
+	labels := map[string]interface{}{"severity": "warning"}
+	var rules []interface{}
+	// A paused rollout keeps the Webserver in the Paused phase on purpose,
+	// so it is not alerted on as not ready.
+	if !instance.Spec.PauseRollout {
+		rules = append(rules, map[string]interface{}{
+			"alert":  "WebserverNotReady",
+			"expr":   fmt.Sprintf("webserver_ready{%s} == 0", selector),
+			"for":    promDuration(notReadyFor),
+			"labels": labels,
+			"annotations": map[string]interface{}{
+				"summary": fmt.Sprintf("Webserver %s/%s has not been ready for %s.", instance.Namespace, instance.Name, promDuration(notReadyFor)),
+			},
+		})
+	}
+	rules = append(rules, map[string]interface{}{
+		"alert":  "WebserverRestarting",
+		"expr":   fmt.Sprintf("delta(webserver_container_restarts{%s}[%s]) >= %d", selector, promDuration(window), threshold),
+		"labels": labels,
+		"annotations": map[string]interface{}{
+			"summary": fmt.Sprintf("Containers of Webserver %s/%s restarted %d or more times in %s.", instance.Namespace, instance.Name, threshold, promDuration(window)),
+		},
+	})
+
+	rule := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"groups": []interface{}{
+				map[string]interface{}{"name": "webserver.rules", "rules": rules},
+			},
+		},
+	}}
+	rule.SetGroupVersionKind(prometheusRuleGVK)
+	rule.SetName(instance.Name)
+	rule.SetNamespace(namespace)
+	rule.SetLabels(labelsForWebserver(instance))
+	return rule
+}
+
+// promDuration formats d in the largest Prometheus duration unit that
+// divides it, such as 10m for ten minutes.
+func promDuration(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+// ingressForWebserver returns the Ingress exposing the Webserver's route
+// Service.
+func ingressForWebserver(instance *serversv1alpha1.Webserver, namespace string) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	service := routeServiceSpec(instance)
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      routeName(instance),
+			Namespace: namespace,
+			Labels:    labelsForWebserver(instance),
+		},
+		Spec: networkingv1.IngressSpec{
+			IngressClassName: instance.Spec.IngressClassName,
+			Rules: []networkingv1.IngressRule{{
+				Host: instance.Spec.IngressHost,
+				IngressRuleValue: networkingv1.IngressRuleValue{
+					HTTP: &networkingv1.HTTPIngressRuleValue{
+						Paths: []networkingv1.HTTPIngressPath{{
+							Path:     "/",
+							PathType: &pathType,
+							Backend: networkingv1.IngressBackend{
+								Service: &networkingv1.IngressServiceBackend{
+									Name: service.Name,
+									Port: networkingv1.ServiceBackendPort{Number: service.Port},
+								},
+							},
+						}},
+					},
+				},
+			}},
+		},
+	}
+	if len(instance.Spec.IngressAnnotations) > 0 {
+		ingress.Annotations = map[string]string{}
+		for k, v := range instance.Spec.IngressAnnotations {
+			ingress.Annotations[k] = v
+		}
+	}
+	return ingress
+}
+
+// routeName returns the name of the Webserver's Route, HTTPRoute or
+// Ingress.
+func routeName(instance *serversv1alpha1.Webserver) string {
+	if instance.Spec.RouteName != "" {
+		return instance.Spec.RouteName
+	}
+	return instance.Name
+}
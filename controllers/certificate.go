@@ -0,0 +1,116 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// defaultExpiryWarning is how long before expiry a certificate is reported
+// when the Webserver does not set ExpiryWarning.
+const defaultExpiryWarning = 30 * 24 * time.Hour
+
+// checkCertificate reads the certificate from the Webserver's TLS Secret,
+// records its expiry in the status and the CertificateExpiring condition,
+// and returns how long until the condition should next change: when the
+// warning window opens or when the certificate expires. It returns zero
+// when there is nothing to wait for.
+func (r *WebserverReconciler) checkCertificate(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string, now time.Time) (time.Duration, error) {
+	tls := instance.Spec.TLS
+	if tls == nil {
+		instance.Status.CertificateNotAfter = nil
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionCertificateExpiring)
+		return 0, nil
+	}
+	warning := defaultExpiryWarning
+	if tls.ExpiryWarning != nil {
+		warning = tls.ExpiryWarning.Duration
+	}
+
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionCertificateExpiring,
+		Status:             metav1.ConditionUnknown,
+		ObservedGeneration: instance.Generation,
+	}
+	defer func() { meta.SetStatusCondition(&instance.Status.Conditions, condition) }()
+
+	key := types.NamespacedName{Name: tls.SecretName, Namespace: namespace}
+	digest, err := r.readSecretDigest(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if digest == nil {
+		instance.Status.CertificateNotAfter = nil
+		condition.Reason = "SecretNotFound"
+		condition.Message = fmt.Sprintf("Secret %s/%s does not exist", namespace, tls.SecretName)
+		return 0, nil
+	}
+	if digest.certificateErr != nil {
+		instance.Status.CertificateNotAfter = nil
+		condition.Reason = "InvalidCertificate"
+		condition.Message = fmt.Sprintf("Secret %s/%s: %v", namespace, tls.SecretName, digest.certificateErr)
+		return 0, nil
+	}
+	notAfter := digest.notAfter
+
+	expiry := metav1.NewTime(notAfter)
+	instance.Status.CertificateNotAfter = &expiry
+	switch remaining := notAfter.Sub(now); {
+	case remaining <= 0:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "Expired"
+		condition.Message = fmt.Sprintf("Certificate expired at %s", notAfter.UTC().Format(time.RFC3339))
+		return 0, nil
+	case remaining <= warning:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ExpiresSoon"
+		condition.Message = fmt.Sprintf("Certificate expires at %s", notAfter.UTC().Format(time.RFC3339))
+		return remaining, nil
+	default:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Valid"
+		condition.Message = fmt.Sprintf("Certificate expires at %s", notAfter.UTC().Format(time.RFC3339))
+		return remaining - warning, nil
+	}
+}
+
+// certificateNotAfter returns the expiry of the first certificate in a PEM
+// bundle, which is the serving certificate.
+func certificateNotAfter(data []byte) (time.Time, error) {
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return cert.NotAfter, nil
+	}
+	return time.Time{}, fmt.Errorf("%s holds no PEM certificate", corev1.TLSCertKey)
+}
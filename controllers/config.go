@@ -0,0 +1,173 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// configChecksumAnnotation records a checksum of the ConfigConfigMap's
+	// data on the pod template, so changing the data rolls the pods.
+	configChecksumAnnotation = "servers.redhat.com/config-checksum"
+
+	// effectiveConfigAnnotation records, on the pod template, a checksum of
+	// the configuration the webserver container runs with: the
+	// ConfigConfigMap data, the referenced Secrets and the container
+	// environment. It only changes
+	// when that configuration does, so sidecars and external tooling can
+	// watch it.
+	effectiveConfigAnnotation = "servers.redhat.com/effective-config-checksum"
+
+	// configMapIndex indexes Webservers by the namespace/name of their
+	// ConfigConfigMap and TemplateRef ConfigMap.
+	configMapIndex = ".spec.configConfigMap"
+)
+
+// applyConfigChecksum looks up the Webserver's ConfigConfigMap, records
+// whether it exists in the ConfigMapAvailable condition and stamps a checksum
+// of its data on the desired Deployment's pod template.
+func (r *WebserverReconciler) applyConfigChecksum(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) error {
+	name := instance.Spec.ConfigConfigMap
+	if name == "" {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionConfigMapAvailable)
+		return nil
+	}
+
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionConfigMapAvailable,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Found",
+	}
+	configMap := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: deployment.Namespace}, configMap)
+	switch {
+	case errors.IsNotFound(err):
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("ConfigMap %s/%s does not exist", deployment.Namespace, name)
+	case err != nil:
+		return err
+	default:
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[configChecksumAnnotation] = configMapChecksum(configMap)
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	return nil
+}
+
+// applyEffectiveConfigChecksum stamps the effectiveConfigAnnotation on the
+// desired Deployment's pod template. It must run after applyConfigChecksum
+// and applySecretChecksum.
+func applyEffectiveConfigChecksum(deployment *appsv1.Deployment) error {
+	template := &deployment.Spec.Template
+	config := struct {
+		ConfigMap string          `json:"configMap"`
+		Secrets   string          `json:"secrets,omitempty"`
+		Env       []corev1.EnvVar `json:"env"`
+	}{
+		ConfigMap: template.Annotations[configChecksumAnnotation],
+		Secrets:   template.Annotations[secretChecksumAnnotation],
+	}
+	for _, container := range template.Spec.Containers {
+		if container.Name == webserverContainerName {
+			config.Env = container.Env
+		}
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	if template.Annotations == nil {
+		template.Annotations = map[string]string{}
+	}
+	template.Annotations[effectiveConfigAnnotation] = fmt.Sprintf("%x", sha256.Sum256(data))
+	return nil
+}
+
+// configMapChecksum returns a stable hash of the ConfigMap's data.
+func configMapChecksum(configMap *corev1.ConfigMap) string {
+	var keys []string
+	for k := range configMap.Data {
+		keys = append(keys, k)
+	}
+	for k := range configMap.BinaryData {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00", k)
+		if v, ok := configMap.Data[k]; ok {
+			h.Write([]byte(v))
+		} else {
+			h.Write(configMap.BinaryData[k])
+		}
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// configMapIndexValue returns the configMapIndex key for a Webserver.
+func configMapIndexValue(obj client.Object) []string {
+	instance := obj.(*serversv1alpha1.Webserver)
+	var values []string
+	if instance.Spec.ConfigConfigMap != "" {
+		values = append(values, targetNamespace(instance)+"/"+instance.Spec.ConfigConfigMap)
+	}
+	if ref := instance.Spec.TemplateRef; ref != nil && ref.Name != instance.Spec.ConfigConfigMap {
+		values = append(values, targetNamespace(instance)+"/"+ref.Name)
+	}
+	return values
+}
+
+// webserversForConfigMap maps a ConfigMap to reconcile requests for the
+// Webservers that mount it or use it as their base template.
+func (r *WebserverReconciler) webserversForConfigMap(obj client.Object) []ctrl.Request {
+	list := &serversv1alpha1.WebserverList{}
+	err := r.Client.List(context.Background(), list,
+		client.MatchingFields{configMapIndex: obj.GetNamespace() + "/" + obj.GetName()})
+	if err != nil {
+		ctrl.Log.WithName("webserver").Error(err, "Listing Webservers for ConfigMap", "configMap", obj.GetName())
+		return nil
+	}
+
+	requests := make([]ctrl.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
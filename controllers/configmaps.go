@@ -0,0 +1,112 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// reconcileExtraConfigMaps applies the Webserver's ExtraConfigMaps and
+// deletes the ones it no longer lists.
+func (r *WebserverReconciler) reconcileExtraConfigMaps(ctx context.Context, instance *serversv1alpha1.Webserver, desired []*corev1.ConfigMap, namespace string) error {
+	var errs []error
+	keep := map[string]bool{}
+	for _, configMap := range desired {
+		keep[configMap.Name] = true
+		if err := r.reconcileConfigMap(ctx, instance, configMap); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := r.deleteStaleConfigMaps(ctx, instance, namespace, keep); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(desired) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionExtraConfigMapsApplied)
+		instance.Status.Resources.ExtraConfigMaps = serversv1alpha1.ResourceStatus{}
+	} else {
+		setAppliedCondition(instance, serversv1alpha1.ConditionExtraConfigMapsApplied, utilerrors.NewAggregate(errs))
+	}
+	return utilerrors.NewAggregate(errs)
+}
+
+// deleteStaleConfigMaps deletes the ConfigMaps the Webserver manages in
+// namespace whose names are not in keep, other than those a
+// ResourceBuilder added.
+func (r *WebserverReconciler) deleteStaleConfigMaps(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string, keep map[string]bool) error {
+	if r.creating {
+		return nil
+	}
+	configMaps := &corev1.ConfigMapList{}
+	err := r.Client.List(ctx, configMaps,
+		client.InNamespace(namespace),
+		client.MatchingLabels{
+			ownerNameLabel:      instance.Name,
+			ownerNamespaceLabel: instance.Namespace,
+		})
+	if err != nil {
+		return err
+	}
+	for i := range configMaps.Items {
+		configMap := &configMaps.Items[i]
+		if keep[configMap.Name] || addedByBuilder(configMap) {
+			continue
+		}
+		log.FromContext(ctx).V(1).Info("Deleting ConfigMap no longer listed", "configMap", configMap.Name)
+		if err := r.Client.Delete(ctx, configMap); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileConfigMap creates or updates one of the Webserver's
+// ExtraConfigMaps to match the desired one.
+func (r *WebserverReconciler) reconcileConfigMap(ctx context.Context, instance *serversv1alpha1.Webserver, desired *corev1.ConfigMap) error {
+	var configMap *corev1.ConfigMap
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+		op, err = r.createOrUpdate(ctx, configMap, func() error {
+			liveVersion = configMap.ResourceVersion
+			configMap.Data = desired.Data
+			configMap.BinaryData = nil
+			return r.setOwner(instance, configMap)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "ConfigMap", desired.Name, liveVersion, configMap.ResourceVersion, err)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled ConfigMap", "configMap", configMap.Name, "operation", op)
+	recordApplied(&instance.Status.Resources.ExtraConfigMaps, liveVersion, configMap.ResourceVersion)
+	return nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/google/go-cmp/cmp"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// updateFunc writes an object, such as client.Client.Update or
+// client.StatusWriter.Update.
+type updateFunc func(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error
+
+// updateWebserver applies mutate to the Webserver and writes it with update.
+// When the write conflicts with another writer, it reads the latest
+// Webserver, applies mutate to that and tries again. On success instance
+// holds the written object.
+func (r *WebserverReconciler) updateWebserver(ctx context.Context, instance *serversv1alpha1.Webserver, update updateFunc, mutate func(*serversv1alpha1.Webserver)) error {
+	latest := instance
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		mutate(latest)
+		err := update(ctx, latest)
+		if errors.IsConflict(err) {
+			// Read into a fresh object so fields dropped by the other writer
+			// are not carried over.
+			fresh := &serversv1alpha1.Webserver{}
+			if err := r.Client.Get(ctx, client.ObjectKeyFromObject(instance), fresh); err != nil {
+				return err
+			}
+			latest = fresh
+		}
+		return err
+	})
+	if err == nil && latest != instance {
+		*instance = *latest
+	}
+	return err
+}
+
+// updateStatus writes the status computed for the Webserver, reapplying it on
+// top of the latest Webserver if another writer got there first.
+func (r *WebserverReconciler) updateStatus(ctx context.Context, instance *serversv1alpha1.Webserver) error {
+	status := instance.Status.DeepCopy()
+	return r.updateWebserver(ctx, instance, r.Status().Update, func(latest *serversv1alpha1.Webserver) {
+		latest.Status = *status.DeepCopy()
+	})
+}
+
+// updateStatusIfChanged writes the Webserver's status if it differs from
+// before.
+func (r *WebserverReconciler) updateStatusIfChanged(ctx context.Context, before *serversv1alpha1.WebserverStatus, instance *serversv1alpha1.Webserver) error {
+	if equality.Semantic.DeepEqual(before, &instance.Status) {
+		return nil
+	}
+	log.FromContext(ctx).V(1).Info("Updating Webserver status", "diff", cmp.Diff(before, &instance.Status))
+	return r.updateStatus(ctx, instance)
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// otherWriterLabel is set by conflictingClient's simulated concurrent writer.
+const otherWriterLabel = "example.com/other-writer"
+
+// conflictingClient simulates another writer: before each of the next
+// conflicts updates it changes the object behind the caller's back, so the
+// caller's update fails with a Conflict.
+type conflictingClient struct {
+	client.Client
+	conflicts int
+}
+
+func (c *conflictingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.interfere(ctx, obj)
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+func (c *conflictingClient) Status() client.StatusWriter {
+	return &conflictingStatusWriter{StatusWriter: c.Client.Status(), c: c}
+}
+
+func (c *conflictingClient) interfere(ctx context.Context, obj client.Object) {
+	if c.conflicts == 0 {
+		return
+	}
+	c.conflicts--
+	other := obj.DeepCopyObject().(client.Object)
+	labels := other.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[otherWriterLabel] = "true"
+	other.SetLabels(labels)
+	Expect(c.Client.Update(ctx, other)).To(Succeed())
+}
+
+type conflictingStatusWriter struct {
+	client.StatusWriter
+	c *conflictingClient
+}
+
+func (w *conflictingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	w.c.interfere(ctx, obj)
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("Conflicting writers", func() {
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+		writer   *conflictingClient
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		count := int32(1)
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       serversv1alpha1.WebserverSpec{Count: &count},
+		}
+		r = newFakeReconciler(instance)
+		writer = &conflictingClient{Client: r.Client}
+		r.Client = writer
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), instance)).To(Succeed())
+	})
+
+	It("retries a status update on top of the other writer's change", func() {
+		writer.conflicts = 2
+		instance.Status.Phase = serversv1alpha1.PhaseReady
+		Expect(r.updateStatus(ctx, instance)).To(Succeed())
+		Expect(writer.conflicts).To(BeZero())
+
+		latest := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), latest)).To(Succeed())
+		Expect(latest.Status.Phase).To(Equal(serversv1alpha1.PhaseReady))
+		Expect(latest.Labels).To(HaveKey(otherWriterLabel))
+	})
+
+	It("retries adding the finalizer", func() {
+		writer.conflicts = 1
+		Expect(r.ensureFinalizer(ctx, instance)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(instance, DefaultFinalizer)).To(BeTrue())
+
+		latest := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), latest)).To(Succeed())
+		Expect(controllerutil.ContainsFinalizer(latest, DefaultFinalizer)).To(BeTrue())
+		Expect(latest.Labels).To(HaveKey(otherWriterLabel))
+	})
+
+	It("retries a Deployment update", func() {
+		desired, err := renderManifests(instance, DefaultFieldManager)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.reconcileDeployment(ctx, instance, desired.Deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer.conflicts = 1
+		replicas := int32(3)
+		desired.Deployment.Spec.Replicas = &replicas
+		_, err = r.reconcileDeployment(ctx, instance, desired.Deployment)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(writer.conflicts).To(BeZero())
+
+		deployment := &appsv1.Deployment{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Deployment), deployment)).To(Succeed())
+		Expect(*deployment.Spec.Replicas).To(Equal(replicas))
+	})
+})
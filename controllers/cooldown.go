@@ -0,0 +1,90 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxFailureBackoff caps the per-item exponential backoff used for failed
+// reconciles, matching the controller-runtime default.
+const maxFailureBackoff = 1000 * time.Second
+
+// newRateLimiter returns the workqueue rate limiter for the controller. With a
+// non-zero cooldown, failed reconciles of a Webserver are never retried sooner
+// than the cooldown.
+func newRateLimiter(cooldown time.Duration) workqueue.RateLimiter {
+	if cooldown <= 0 {
+		return workqueue.DefaultControllerRateLimiter()
+	}
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.DefaultControllerRateLimiter(),
+		workqueue.NewItemExponentialFailureRateLimiter(cooldown, maxFailureBackoff),
+	)
+}
+
+// cooldown enforces a minimum interval between reconciles of the same
+// Webserver. Watch events bypass the workqueue rate limiter, so this is
+// checked at the start of each reconcile.
+type cooldown struct {
+	interval time.Duration
+
+	mu   sync.Mutex
+	last map[types.NamespacedName]time.Time
+}
+
+func newCooldown(interval time.Duration) *cooldown {
+	return &cooldown{
+		interval: interval,
+		last:     map[types.NamespacedName]time.Time{},
+	}
+}
+
+// wait returns how long the reconcile of key must be delayed. A zero result
+// means the reconcile may proceed and is recorded as the latest one.
+func (c *cooldown) wait(key types.NamespacedName) time.Duration {
+	if c == nil || c.interval <= 0 {
+		return 0
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if last, ok := c.last[key]; ok {
+		if d := c.interval - now.Sub(last); d > 0 {
+			return d
+		}
+	}
+	c.last[key] = now
+	return 0
+}
+
+// forget drops the bookkeeping for a Webserver that no longer exists.
+func (c *cooldown) forget(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.last, key)
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// correlationIDAnnotation carries the reconcile's correlation ID on the
+// Events it emits.
+const correlationIDAnnotation = "servers.redhat.com/correlation-id"
+
+type correlationIDKey struct{}
+
+// correlationID identifies the spec a reconcile works from by the
+// Webserver's generation, such as "3". The resourceVersion is left out:
+// the operator's own status writes bump it, so it would give each
+// reconcile of the same change a new ID.
+func correlationID(instance *serversv1alpha1.Webserver) string {
+	return strconv.FormatInt(instance.Generation, 10)
+}
+
+// withCorrelationID returns ctx with the Webserver's correlation ID added to
+// its logger, so that every line the reconcile logs carries it, and stored
+// for the Events the reconcile emits.
+func withCorrelationID(ctx context.Context, instance *serversv1alpha1.Webserver) context.Context {
+	if _, ok := ctx.Value(correlationIDKey{}).(string); ok {
+		// Observe mode runs the reconcile again with the same context, from
+		// a Webserver read again; the logger already carries the ID.
+		return ctx
+	}
+	id := correlationID(instance)
+	ctx = log.IntoContext(ctx, log.FromContext(ctx).WithValues("correlationID", id))
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// event emits an event about the Webserver, if the reconciler has a
+// Recorder, annotated with the reconcile's correlation ID.
+func (r *WebserverReconciler) event(ctx context.Context, instance *serversv1alpha1.Webserver, eventType, reason, messageFmt string, args ...interface{}) {
+	if r.Recorder == nil {
+		return
+	}
+	id, ok := ctx.Value(correlationIDKey{}).(string)
+	if !ok {
+		r.Recorder.Eventf(instance, eventType, reason, messageFmt, args...)
+		return
+	}
+	r.Recorder.AnnotatedEventf(instance, map[string]string{correlationIDAnnotation: id}, eventType, reason, messageFmt, args...)
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/discovery"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// crdPollInterval is how often CRDWaiter looks for missing CRDs.
+const crdPollInterval = 2 * time.Second
+
+var (
+	// RequiredCRDs are the resources the controller cannot start without.
+	RequiredCRDs = []schema.GroupVersionResource{
+		serversv1alpha1.GroupVersion.WithResource("webservers"),
+	}
+
+	// OptionalCRDs are the resources of features that are disabled when
+	// their CRDs are not installed: OpenShift Routes, Gateway API
+	// HTTPRoutes and Prometheus Operator PrometheusRules.
+	OptionalCRDs = []schema.GroupVersionResource{
+		{Group: "route.openshift.io", Version: "v1", Resource: "routes"},
+		httpRouteGVK.GroupVersion().WithResource("httproutes"),
+		prometheusRuleGVK.GroupVersion().WithResource("prometheusrules"),
+	}
+)
+
+// CRDWaiter waits at startup for the API server to serve RequiredCRDs, which
+// only happens once their CRDs are established, so the controller does not
+// start watching kinds that do not exist yet. Its Check reports the wait as
+// a readyz check.
+type CRDWaiter struct {
+	discovery discovery.DiscoveryInterface
+
+	mu      sync.Mutex
+	missing []schema.GroupVersionResource
+	done    bool
+}
+
+// NewCRDWaiter returns a CRDWaiter that looks the CRDs up through d.
+func NewCRDWaiter(d discovery.DiscoveryInterface) *CRDWaiter {
+	return &CRDWaiter{discovery: d, missing: RequiredCRDs}
+}
+
+// Wait blocks until every required CRD is served, giving up after timeout.
+// It then logs the optional CRDs that are not installed, whose features
+// stay disabled until the operator restarts.
+func (w *CRDWaiter) Wait(ctx context.Context, timeout time.Duration) error {
+	logger := ctrl.Log.WithName("crds")
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	logged := false
+	err := wait.PollImmediateUntil(crdPollInterval, func() (bool, error) {
+		missing := w.find(RequiredCRDs)
+		w.mu.Lock()
+		w.missing = missing
+		w.mu.Unlock()
+		if len(missing) > 0 && !logged {
+			logger.Info("Waiting for required CRDs", "missing", resourceNames(missing))
+			logged = true
+		}
+		return len(missing) == 0, nil
+	}, ctx.Done())
+	if err != nil {
+		return fmt.Errorf("required CRDs %s are not installed after %s", resourceNames(w.missingCRDs()), timeout)
+	}
+
+	for _, gvr := range w.find(OptionalCRDs) {
+		logger.Info("Optional CRD is not installed; its features are disabled", "resource", gvr.GroupResource().String())
+	}
+	w.mu.Lock()
+	w.done = true
+	w.mu.Unlock()
+	return nil
+}
+
+// Check implements healthz.Checker, failing until Wait has found every
+// required CRD.
+func (w *CRDWaiter) Check(*http.Request) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done {
+		return nil
+	}
+	return fmt.Errorf("waiting for CRDs %s", resourceNames(w.missing))
+}
+
+// missingCRDs returns the required CRDs last found missing.
+func (w *CRDWaiter) missingCRDs() []schema.GroupVersionResource {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.missing
+}
+
+// find returns the resources in gvrs the API server does not serve.
+func (w *CRDWaiter) find(gvrs []schema.GroupVersionResource) []schema.GroupVersionResource {
+	var missing []schema.GroupVersionResource
+	for _, gvr := range gvrs {
+		served := false
+		if list, err := w.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String()); err == nil {
+			for _, resource := range list.APIResources {
+				served = served || resource.Name == gvr.Resource
+			}
+		}
+		if !served {
+			missing = append(missing, gvr)
+		}
+	}
+	return missing
+}
+
+// resourceNames formats gvrs as a comma-separated list of resource.group
+// names, as CRDs are named.
+func resourceNames(gvrs []schema.GroupVersionResource) string {
+	names := make([]string, 0, len(gvrs))
+	for _, gvr := range gvrs {
+		names = append(names, gvr.GroupResource().String())
+	}
+	return strings.Join(names, ", ")
+}
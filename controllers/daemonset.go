@@ -0,0 +1,146 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// reconcileDaemonSetWorkload runs the Webserver's pods from its DaemonSet:
+// it applies the DaemonSet, then removes the workloads left from before a
+// switch, and records the DaemonSet's pods in status. Like
+// updateRolloutStatus it returns how long to back off while pods are crash
+// looping, and like setStableCondition how long until the pods are stable.
+func (r *WebserverReconciler) reconcileDaemonSetWorkload(ctx context.Context, instance *serversv1alpha1.Webserver, desired *manifests, namespace string, now time.Time) (backoff, stableAfter time.Duration, err error) {
+	daemonSet, err := r.reconcileDaemonSet(ctx, instance, desired.DaemonSet)
+	setAppliedCondition(instance, serversv1alpha1.ConditionDaemonSetApplied, err)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := r.deleteOtherWorkloads(ctx, instance, namespace); err != nil {
+		return 0, 0, err
+	}
+	for _, service := range desired.Services {
+		service.Spec.Selector = daemonSet.Spec.Selector.MatchLabels
+	}
+	instance.Status.SelectorLabels = copyStringMap(daemonSet.Spec.Selector.MatchLabels)
+
+	pods, err := r.listPods(ctx, daemonSet.Namespace, daemonSet.Spec.Selector.MatchLabels)
+	if err != nil {
+		return 0, 0, err
+	}
+	instance.Status.Summary = podSummary(pods)
+	instance.Status.Pods = podInfos(pods)
+	if imageID := runningImageID(pods); imageID != "" {
+		instance.Status.ImageID = imageID
+	}
+	instance.Status.Phase = daemonSetPhase(daemonSet, pods)
+	setDegradedCondition(instance, pods, false)
+	return crashLoopRequeue(ctx, pods), setStableCondition(instance, daemonSetReady(daemonSet), now), nil
+}
+
+// reconcileDaemonSet creates or updates the Webserver's DaemonSet to match
+// the desired one.
+func (r *WebserverReconciler) reconcileDaemonSet(ctx context.Context, instance *serversv1alpha1.Webserver, desired *appsv1.DaemonSet) (*appsv1.DaemonSet, error) {
+	var daemonSet *appsv1.DaemonSet
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		daemonSet = &appsv1.DaemonSet{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+		op, err = r.createOrUpdate(ctx, daemonSet, func() error {
+			liveVersion = daemonSet.ResourceVersion
+			if daemonSet.CreationTimestamp.IsZero() {
+				daemonSet.Spec.Selector = desired.Spec.Selector
+			}
+			daemonSet.Labels = desired.Labels
+			if cause, ok := desired.Annotations[changeCauseAnnotation]; ok {
+				if daemonSet.Annotations == nil {
+					daemonSet.Annotations = map[string]string{}
+				}
+				daemonSet.Annotations[changeCauseAnnotation] = cause
+			} else {
+				delete(daemonSet.Annotations, changeCauseAnnotation)
+			}
+
+			template := liveTemplate(&desired.Spec.Template, &daemonSet.Spec.Template, daemonSet.Spec.Selector)
+			applyTemplate(daemonSet, &daemonSet.Spec.Template, template)
+			return r.setOwner(instance, daemonSet)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "DaemonSet", desired.Name, liveVersion, daemonSet.ResourceVersion, err)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled DaemonSet", "daemonSet", daemonSet.Name, "operation", op)
+	recordApplied(&instance.Status.Resources.DaemonSet, liveVersion, daemonSet.ResourceVersion)
+	return daemonSet, nil
+}
+
+// liveTemplate returns the desired pod template for a live DaemonSet or
+// StatefulSet. Their selectors are immutable, so the pods must keep the
+// labels of the selector the workload was created with, and a restart
+// requested with kubectl rollout restart is kept.
+func liveTemplate(desired, live *corev1.PodTemplateSpec, selector *metav1.LabelSelector) *corev1.PodTemplateSpec {
+	template := desired.DeepCopy()
+	for k, v := range selector.MatchLabels {
+		template.Labels[k] = v
+	}
+	if restartedAt := live.Annotations[restartedAtAnnotation]; restartedAt != "" {
+		if template.Annotations == nil {
+			template.Annotations = map[string]string{}
+		}
+		template.Annotations[restartedAtAnnotation] = restartedAt
+	}
+	return template
+}
+
+// daemonSetPhase derives the Webserver's phase from its DaemonSet and pods.
+func daemonSetPhase(daemonSet *appsv1.DaemonSet, pods []corev1.Pod) serversv1alpha1.WebserverPhase {
+	for i := range pods {
+		if podCrashLooping(&pods[i]) {
+			return serversv1alpha1.PhaseDegraded
+		}
+	}
+	if daemonSet.Status.ObservedGeneration == 0 {
+		return serversv1alpha1.PhasePending
+	}
+	if daemonSetReady(daemonSet) {
+		return serversv1alpha1.PhaseReady
+	}
+	return serversv1alpha1.PhaseProgressing
+}
+
+// daemonSetReady reports whether the DaemonSet controller has observed the
+// current generation and every node it schedules to runs a ready, updated
+// pod.
+func daemonSetReady(daemonSet *appsv1.DaemonSet) bool {
+	status := daemonSet.Status
+	return status.ObservedGeneration >= daemonSet.Generation &&
+		status.UpdatedNumberScheduled == status.DesiredNumberScheduled &&
+		status.NumberReady == status.DesiredNumberScheduled
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// pinDefaultImage keeps a Webserver that relies on the default image on the
+// default it was last rolled out with, so changing DefaultImage does not
+// roll every such Webserver as soon as the operator restarts. The new
+// default is picked up when the Webserver's spec next changes, or straight
+// away with RollOutDefaultImage.
+func (r *WebserverReconciler) pinDefaultImage(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) {
+	if instance.Spec.Image != "" {
+		instance.Status.DefaultImage = ""
+		return
+	}
+
+	pinned := instance.Status.DefaultImage
+	appliedType := serversv1alpha1.ConditionDeploymentApplied
+	switch instance.Spec.WorkloadType {
+	case serversv1alpha1.WorkloadDaemonSet:
+		appliedType = serversv1alpha1.ConditionDaemonSetApplied
+	case serversv1alpha1.WorkloadStatefulSet:
+		appliedType = serversv1alpha1.ConditionStatefulSetApplied
+	}
+	applied := meta.FindStatusCondition(instance.Status.Conditions, appliedType)
+	unchanged := applied != nil && applied.ObservedGeneration == instance.Generation
+	if pinned == "" || pinned == DefaultImage || r.RollOutDefaultImage || !unchanged {
+		instance.Status.DefaultImage = DefaultImage
+		return
+	}
+
+	image, _ := mirrorImage(pinned)
+	for i := range deployment.Spec.Template.Spec.Containers {
+		if container := &deployment.Spec.Template.Spec.Containers[i]; container.Name == webserverContainerName {
+			container.Image = image
+		}
+	}
+	log.FromContext(ctx).V(1).Info("Keeping previous default image until the Webserver changes", "image", pinned, "default", DefaultImage)
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// dependencyRequeueAfter is how long to wait before looking for missing
+// dependencies again. Creating a watched dependency triggers a reconcile
+// sooner.
+const dependencyRequeueAfter = time.Minute
+
+// missingDependencies returns the objects the Webserver's pods reference in
+// namespace that do not exist yet, as "Kind/name".
+func (r *WebserverReconciler) missingDependencies(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string) ([]string, error) {
+	type dependency struct {
+		kind string
+		obj  client.Object
+	}
+	var deps []dependency
+	if name := instance.Spec.ConfigConfigMap; name != "" {
+		deps = append(deps, dependency{"ConfigMap", &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}}})
+	}
+	if tls := instance.Spec.TLS; tls != nil && tls.SecretName != "" {
+		// Only Secret metadata is cached, so look the Secret up by it.
+		secret := &metav1.PartialObjectMetadata{ObjectMeta: metav1.ObjectMeta{Name: tls.SecretName}}
+		secret.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		deps = append(deps, dependency{"Secret", secret})
+	}
+
+	var missing []string
+	for _, dep := range deps {
+		name := dep.obj.GetName()
+		err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: namespace}, dep.obj)
+		switch {
+		case errors.IsNotFound(err):
+			missing = append(missing, dep.kind+"/"+name)
+		case err != nil:
+			return nil, err
+		}
+	}
+	return missing, nil
+}
+
+// setDependencyCondition records in the WaitingForDependency condition
+// whether any of the Webserver's dependencies are missing.
+func setDependencyCondition(instance *serversv1alpha1.Webserver, missing []string) {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionWaitingForDependency,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "DependenciesFound",
+	}
+	if len(missing) > 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DependencyNotFound"
+		condition.Message = fmt.Sprintf("Waiting for %s to be created", strings.Join(missing, ", "))
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
@@ -0,0 +1,314 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// reconcileExposure applies the Route, HTTPRoute or Ingress the Webserver
+// is exposed through and removes the others, recording the exposed host in
+// status.
+func (r *WebserverReconciler) reconcileExposure(ctx context.Context, instance *serversv1alpha1.Webserver, desired *manifests, namespace string) error {
+	var errs []error
+
+	// Any other Route, HTTPRoute or Ingress the Webserver manages was
+	// created under an earlier RouteName, or for the exposure it no longer
+	// uses.
+	keep := ""
+	if desired.Route != nil {
+		keep = desired.Route.Name
+	}
+	if err := r.deleteOwnedExcept(ctx, instance, namespace, &routev1.RouteList{}, keep); err != nil {
+		errs = append(errs, err)
+	}
+	keep = ""
+	if desired.HTTPRoute != nil {
+		keep = desired.HTTPRoute.GetName()
+	}
+	httpRoutes := &unstructured.UnstructuredList{}
+	httpRoutes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind(httpRouteGVK.Kind + "List"))
+	if err := r.deleteOwnedExcept(ctx, instance, namespace, httpRoutes, keep); err != nil {
+		errs = append(errs, err)
+	}
+	keep = ""
+	if desired.Ingress != nil {
+		keep = desired.Ingress.Name
+	}
+	if err := r.deleteOwnedExcept(ctx, instance, namespace, &networkingv1.IngressList{}, keep); err != nil {
+		errs = append(errs, err)
+	}
+
+	if desired.Route != nil {
+		route, err := r.reconcileRoute(ctx, instance, desired.Route)
+		setAppliedCondition(instance, serversv1alpha1.ConditionRouteApplied, err)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			instance.Status.Host = route.Spec.Host
+			trackAdmittedHost(instance, route)
+		}
+	} else if !desired.RouteHeld {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionRouteApplied)
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionHostChanged)
+		instance.Status.Resources.Route = serversv1alpha1.ResourceStatus{}
+		instance.Status.Host = ""
+		instance.Status.AdmittedHost = ""
+	}
+	// A Route held back from being recreated keeps its host and admitted
+	// host, so a host change is still noticed once it is recreated.
+
+	if desired.HTTPRoute != nil {
+		err := r.reconcileHTTPRoute(ctx, instance, desired.HTTPRoute)
+		setAppliedCondition(instance, serversv1alpha1.ConditionHTTPRouteApplied, err)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			instance.Status.Host = instance.Spec.Gateway.Hostname
+		}
+	} else {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionHTTPRouteApplied)
+		instance.Status.Resources.HTTPRoute = serversv1alpha1.ResourceStatus{}
+	}
+
+	if desired.Ingress != nil {
+		err := r.reconcileIngress(ctx, instance, desired.Ingress)
+		setAppliedCondition(instance, serversv1alpha1.ConditionIngressApplied, err)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			instance.Status.Host = instance.Spec.IngressHost
+		}
+	} else {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionIngressApplied)
+		instance.Status.Resources.Ingress = serversv1alpha1.ResourceStatus{}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// trackAdmittedHost records the host the router admitted route with. When
+// it differs from the host admitted before, it sets the HostChanged
+// condition and counts the change; the condition is cleared once the
+// Webserver's spec changes. A Route the router has not admitted keeps the
+// last known host.
+func trackAdmittedHost(instance *serversv1alpha1.Webserver, route *routev1.Route) {
+	host := admittedHost(route)
+	previous := instance.Status.AdmittedHost
+	if host != "" && previous != "" && host != previous {
+		routeHostChanges.WithLabelValues(instance.Namespace, instance.Name).Inc()
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionHostChanged,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: instance.Generation,
+			Reason:             "AdmittedHostChanged",
+			Message:            fmt.Sprintf("Route %s was admitted with host %s instead of %s", route.Name, host, previous),
+		})
+	} else if c := meta.FindStatusCondition(instance.Status.Conditions, serversv1alpha1.ConditionHostChanged); c == nil || c.ObservedGeneration != instance.Generation {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionHostChanged,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: instance.Generation,
+			Reason:             "Unchanged",
+		})
+	}
+	if host != "" {
+		instance.Status.AdmittedHost = host
+	}
+}
+
+// admittedHost returns the host of the first router that admitted route,
+// or "" if none has.
+func admittedHost(route *routev1.Route) string {
+	for _, ingress := range route.Status.Ingress {
+		for _, condition := range ingress.Conditions {
+			if condition.Type == routev1.RouteAdmitted && condition.Status == corev1.ConditionTrue {
+				return ingress.Host
+			}
+		}
+	}
+	return ""
+}
+
+// reconcileIngress creates or updates the Webserver's Ingress to match the
+// desired one. Annotations the Webserver no longer sets are removed, while
+// those added by others are kept.
+func (r *WebserverReconciler) reconcileIngress(ctx context.Context, instance *serversv1alpha1.Webserver, desired *networkingv1.Ingress) error {
+	var ingress *networkingv1.Ingress
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		ingress = &networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+		op, err = r.createOrUpdate(ctx, ingress, func() error {
+			liveVersion = ingress.ResourceVersion
+			ingress.Labels = desired.Labels
+			ingress.Spec = desired.Spec
+			applyIngressAnnotations(ingress, desired.Annotations)
+			return r.setOwner(instance, ingress)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "Ingress", desired.Name, liveVersion, ingress.ResourceVersion, err)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled Ingress", "ingress", ingress.Name, "operation", op)
+	recordApplied(&instance.Status.Resources.Ingress, liveVersion, ingress.ResourceVersion)
+	return nil
+}
+
+// applyIngressAnnotations sets annotations on ingress, removes the ones the
+// operator set earlier that are no longer wanted, and records the keys it
+// manages in ingressAnnotationsAnnotation.
+func applyIngressAnnotations(ingress *networkingv1.Ingress, annotations map[string]string) {
+	for _, key := range strings.Split(ingress.Annotations[ingressAnnotationsAnnotation], ",") {
+		if _, ok := annotations[key]; !ok {
+			delete(ingress.Annotations, key)
+		}
+	}
+	delete(ingress.Annotations, ingressAnnotationsAnnotation)
+	if len(annotations) == 0 {
+		return
+	}
+	if ingress.Annotations == nil {
+		ingress.Annotations = map[string]string{}
+	}
+	keys := make([]string, 0, len(annotations))
+	for k, v := range annotations {
+		ingress.Annotations[k] = v
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ingress.Annotations[ingressAnnotationsAnnotation] = strings.Join(keys, ",")
+}
+
+// ingressAnnotationsAnnotation lists, on the Ingress, the keys of the
+// annotations set from IngressAnnotations, so that removing one from the
+// Webserver removes it from the Ingress.
+const ingressAnnotationsAnnotation = "servers.redhat.com/ingress-annotations"
+
+// reconcileHTTPRoute creates or updates the Webserver's Gateway API
+// HTTPRoute to match the desired one.
+func (r *WebserverReconciler) reconcileHTTPRoute(ctx context.Context, instance *serversv1alpha1.Webserver, desired *unstructured.Unstructured) error {
+	available, err := r.httpRouteAvailable()
+	if err == nil && !available {
+		err = fmt.Errorf("the %s HTTPRoute CRD is not installed", httpRouteGVK.GroupVersion())
+	}
+	if err != nil {
+		recordAction(ctx, instance, "HTTPRoute", desired.GetName(), "", "", err)
+		return err
+	}
+
+	var route *unstructured.Unstructured
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		route = &unstructured.Unstructured{}
+		route.SetGroupVersionKind(httpRouteGVK)
+		route.SetName(desired.GetName())
+		route.SetNamespace(desired.GetNamespace())
+		op, err = r.createOrUpdate(ctx, route, func() error {
+			liveVersion = route.GetResourceVersion()
+			route.Object["spec"] = runtime.DeepCopyJSONValue(desired.Object["spec"])
+			return r.setOwner(instance, route)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "HTTPRoute", desired.GetName(), liveVersion, route.GetResourceVersion(), err)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled HTTPRoute", "httpRoute", route.GetName(), "operation", op)
+	recordApplied(&instance.Status.Resources.HTTPRoute, liveVersion, route.GetResourceVersion())
+	return nil
+}
+
+// routeAvailable reports whether the cluster serves the OpenShift Route.
+func (r *WebserverReconciler) routeAvailable() (bool, error) {
+	gvk := routev1.SchemeGroupVersion.WithKind("Route")
+	_, err := r.Client.RESTMapper().RESTMapping(gvk.GroupKind(), gvk.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// httpRouteAvailable reports whether the cluster serves the Gateway API
+// HTTPRoute.
+func (r *WebserverReconciler) httpRouteAvailable() (bool, error) {
+	_, err := r.Client.RESTMapper().RESTMapping(httpRouteGVK.GroupKind(), httpRouteGVK.Version)
+	if meta.IsNoMatchError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// applyRouteMetadata sets the desired labels and annotations on the live
+// Route. With the Replace policy they become the Route's only ones. Otherwise
+// they are merged in, and of the others only the annotations the operator
+// manages are removed when no longer desired.
+func applyRouteMetadata(route, desired *routev1.Route, policy serversv1alpha1.RouteMetadataPolicy) {
+	if policy == serversv1alpha1.RouteMetadataReplace {
+		route.Labels = copyStringMap(desired.Labels)
+		route.Annotations = copyStringMap(desired.Annotations)
+		return
+	}
+	if len(desired.Labels) > 0 && route.Labels == nil {
+		route.Labels = map[string]string{}
+	}
+	for k, v := range desired.Labels {
+		route.Labels[k] = v
+	}
+	if _, ok := desired.Annotations[routeTimeoutAnnotation]; !ok {
+		delete(route.Annotations, routeTimeoutAnnotation)
+	}
+	if len(desired.Annotations) > 0 && route.Annotations == nil {
+		route.Annotations = map[string]string{}
+	}
+	for k, v := range desired.Annotations {
+		route.Annotations[k] = v
+	}
+}
+
+// copyStringMap returns a copy of m, or nil when m is empty.
+func copyStringMap(m map[string]string) map[string]string {
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
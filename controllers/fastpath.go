@@ -0,0 +1,81 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// ownsNothing reports whether the Webserver has never been applied and no
+// Deployment, DaemonSet or StatefulSet in namespace is labelled as its own,
+// in which case the reconcile can create its objects without first reading
+// or cleaning up existing ones. The workloads are listed from the cache;
+// other kinds of objects left behind are adopted when their create fails.
+func (r *WebserverReconciler) ownsNothing(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string) (bool, error) {
+	if instance.Status.TargetNamespace != "" || len(instance.Status.Objects) > 0 {
+		return false, nil
+	}
+	owned := client.MatchingLabels{
+		ownerNameLabel:      instance.Name,
+		ownerNamespaceLabel: instance.Namespace,
+	}
+	for _, list := range []client.ObjectList{&appsv1.DeploymentList{}, &appsv1.DaemonSetList{}, &appsv1.StatefulSetList{}} {
+		if err := r.Client.List(ctx, list, client.InNamespace(namespace), owned); err != nil {
+			return false, err
+		}
+		if meta.LenList(list) > 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// createOrUpdate is controllerutil.CreateOrUpdate, except that on the
+// create-only fast path it skips the read and creates obj straight away.
+// If the object turns out to exist, the fast path is left and a conflict
+// is returned, so that the caller's retry.RetryOnConflict starts over from
+// a fresh object and takes the usual path.
+func (r *WebserverReconciler) createOrUpdate(ctx context.Context, obj client.Object, f controllerutil.MutateFn) (controllerutil.OperationResult, error) {
+	if !r.creating {
+		return controllerutil.CreateOrUpdate(ctx, r.Client, obj, f)
+	}
+	key := client.ObjectKeyFromObject(obj)
+	if err := f(); err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	err := r.Client.Create(ctx, obj)
+	if errors.IsAlreadyExists(err) {
+		r.creating = false
+		gvk, _ := apiutil.GVKForObject(obj, r.Client.Scheme())
+		return controllerutil.OperationResultNone, errors.NewConflict(
+			schema.GroupResource{Group: gvk.Group, Resource: gvk.Kind}, key.Name, err)
+	}
+	if err != nil {
+		return controllerutil.OperationResultNone, err
+	}
+	return controllerutil.OperationResultCreated, nil
+}
@@ -0,0 +1,51 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// DefaultFieldManager is the field manager and managed-by label value used
+// when none is configured.
+const DefaultFieldManager = "sample-operator"
+
+// fieldOwnerClient records every write it makes under a single field
+// manager name, so operator-managed fields can be told apart from edits made
+// by people or other tools.
+type fieldOwnerClient struct {
+	client.Client
+	owner client.FieldOwner
+}
+
+func newFieldOwnerClient(c client.Client, owner string) client.Client {
+	return &fieldOwnerClient{Client: c, owner: client.FieldOwner(owner)}
+}
+
+func (c *fieldOwnerClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	return c.Client.Create(ctx, obj, append([]client.CreateOption{c.owner}, opts...)...)
+}
+
+func (c *fieldOwnerClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	return c.Client.Update(ctx, obj, append([]client.UpdateOption{c.owner}, opts...)...)
+}
+
+func (c *fieldOwnerClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	return c.Client.Patch(ctx, obj, patch, append([]client.PatchOption{c.owner}, opts...)...)
+}
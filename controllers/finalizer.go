@@ -0,0 +1,99 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// DefaultFinalizer is the finalizer that blocks deletion of a Webserver
+// until its cleanup hook has run, unless the reconciler sets another name.
+const DefaultFinalizer = "servers.redhat.com/finalizer"
+
+// CleanupHook releases resources created outside the cluster for a
+// Webserver, such as DNS records pointing at its Route host. It is called
+// when the Webserver is deleted, before the finalizer is removed, and must
+// not assume the Route still exists; the last known host is available in
+// the Webserver's status.
+type CleanupHook interface {
+	Cleanup(ctx context.Context, instance *serversv1alpha1.Webserver) error
+}
+
+// NoopCleanupHook is the default CleanupHook. It does nothing.
+type NoopCleanupHook struct{}
+
+// Cleanup implements CleanupHook.
+func (NoopCleanupHook) Cleanup(context.Context, *serversv1alpha1.Webserver) error {
+	return nil
+}
+
+// finalizer returns the name of the operator's finalizer.
+func (r *WebserverReconciler) finalizer() string {
+	if r.Finalizer != "" {
+		return r.Finalizer
+	}
+	return DefaultFinalizer
+}
+
+// ensureFinalizer adds the Webserver finalizer if it is missing.
+func (r *WebserverReconciler) ensureFinalizer(ctx context.Context, instance *serversv1alpha1.Webserver) error {
+	if controllerutil.ContainsFinalizer(instance, r.finalizer()) {
+		return nil
+	}
+	return r.updateWebserver(ctx, instance, r.Client.Update, func(latest *serversv1alpha1.Webserver) {
+		controllerutil.AddFinalizer(latest, r.finalizer())
+	})
+}
+
+// finalize runs the cleanup hook for a Webserver that is being deleted and
+// then removes the operator's finalizer so deletion can proceed. While any
+// finalizer in FinalizeAfter is still present it does nothing; removing
+// that finalizer updates the Webserver and triggers another reconcile.
+// Finalizers of other controllers are left alone.
+func (r *WebserverReconciler) finalize(ctx context.Context, instance *serversv1alpha1.Webserver) error {
+	if !controllerutil.ContainsFinalizer(instance, r.finalizer()) {
+		return nil
+	}
+	for _, other := range r.FinalizeAfter {
+		if controllerutil.ContainsFinalizer(instance, other) {
+			log.FromContext(ctx).V(1).Info("Waiting for finalizer to be removed first", "finalizer", other)
+			return nil
+		}
+	}
+
+	// Resources outside the Webserver's namespace cannot be owner-referenced,
+	// so garbage collection will not remove them.
+	if ns := instance.Status.TargetNamespace; ns != "" && ns != instance.Namespace {
+		if err := r.deleteOwnedObjects(ctx, instance, ns); err != nil {
+			return err
+		}
+	}
+
+	log.FromContext(ctx).Info("Running cleanup for deleted Webserver", "host", instance.Status.Host)
+	if err := r.CleanupHook.Cleanup(ctx, instance); err != nil {
+		return err
+	}
+
+	return r.updateWebserver(ctx, instance, r.Client.Update, func(latest *serversv1alpha1.Webserver) {
+		controllerutil.RemoveFinalizer(latest, r.finalizer())
+	})
+}
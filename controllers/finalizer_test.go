@@ -0,0 +1,125 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// countingCleanupHook counts the Webservers it cleaned up.
+type countingCleanupHook struct {
+	calls int
+}
+
+func (h *countingCleanupHook) Cleanup(context.Context, *serversv1alpha1.Webserver) error {
+	h.calls++
+	return nil
+}
+
+var _ = Describe("Finalizers", func() {
+	const (
+		ours     = "chain.example.com/webserver"
+		dns      = "dns.example.com/records"
+		auditLog = "audit.example.com/log"
+	)
+
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+		hook     *countingCleanupHook
+		req      ctrl.Request
+	)
+
+	// removeFinalizer removes name from the live Webserver, as its owning
+	// controller would.
+	removeFinalizer := func(name string) {
+		latest := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, req.NamespacedName, latest)).To(Succeed())
+		var kept []string
+		for _, f := range latest.Finalizers {
+			if f != name {
+				kept = append(kept, f)
+			}
+		}
+		latest.Finalizers = kept
+		Expect(r.Client.Update(ctx, latest)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       "web",
+				Namespace:  "default",
+				UID:        "uid-current",
+				Finalizers: []string{ours, dns, auditLog},
+			},
+		}
+		hook = &countingCleanupHook{}
+		r = newFakeReconciler(instance)
+		r.Finalizer = ours
+		r.FinalizeAfter = []string{dns}
+		r.CleanupHook = hook
+		r.setDefaults()
+		req = ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)}
+	})
+
+	It("adds the configured finalizer only", func() {
+		fresh := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "fresh", Namespace: "default"}}
+		Expect(r.Client.Create(ctx, fresh)).To(Succeed())
+		Expect(r.ensureFinalizer(ctx, fresh)).To(Succeed())
+		Expect(fresh.Finalizers).To(Equal([]string{ours}))
+	})
+
+	It("removes its finalizer after the ones it finalizes after, leaving the others", func() {
+		Expect(r.Client.Delete(ctx, instance)).To(Succeed())
+
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		latest := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, req.NamespacedName, latest)).To(Succeed())
+		Expect(latest.Finalizers).To(Equal([]string{ours, dns, auditLog}))
+		Expect(hook.calls).To(BeZero())
+
+		removeFinalizer(dns)
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Client.Get(ctx, req.NamespacedName, latest)).To(Succeed())
+		Expect(latest.Finalizers).To(Equal([]string{auditLog}))
+		Expect(hook.calls).To(Equal(1))
+
+		// Once only another controller's finalizer is left, reconciles do
+		// not touch the Webserver.
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(hook.calls).To(Equal(1))
+
+		removeFinalizer(auditLog)
+		err = r.Client.Get(ctx, req.NamespacedName, latest)
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,71 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// namespaceLimiter bounds how many expensive operations, such as reachability
+// checks, run at once for Webservers in the same namespace, so one team's
+// slow Webservers cannot tie up every reconcile worker.
+type namespaceLimiter struct {
+	limit int
+
+	mu   sync.Mutex
+	sems map[string]chan struct{}
+}
+
+func newNamespaceLimiter(limit int) *namespaceLimiter {
+	return &namespaceLimiter{
+		limit: limit,
+		sems:  map[string]chan struct{}{},
+	}
+}
+
+// acquire blocks until an operation may run in namespace or ctx is done. The
+// returned function must be called once the operation has finished. A nil
+// limiter or a non-positive limit never blocks.
+func (l *namespaceLimiter) acquire(ctx context.Context, namespace string) (func(), error) {
+	start := time.Now()
+	if l == nil || l.limit <= 0 {
+		limiterInFlight.WithLabelValues(namespace).Inc()
+		return func() { limiterInFlight.WithLabelValues(namespace).Dec() }, nil
+	}
+
+	l.mu.Lock()
+	sem, ok := l.sems[namespace]
+	if !ok {
+		sem = make(chan struct{}, l.limit)
+		l.sems[namespace] = sem
+	}
+	l.mu.Unlock()
+
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	limiterWaitSeconds.WithLabelValues(namespace).Observe(time.Since(start).Seconds())
+	limiterInFlight.WithLabelValues(namespace).Inc()
+	return func() {
+		limiterInFlight.WithLabelValues(namespace).Dec()
+		<-sem
+	}, nil
+}
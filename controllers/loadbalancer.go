@@ -0,0 +1,73 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// setLoadBalancerCondition records in the LoadBalancerProvisioned condition
+// whether the cluster has given every LoadBalancer Service among services an
+// external address. The Service watch reconciles the Webserver again once
+// the cluster assigns one.
+func setLoadBalancerCondition(instance *serversv1alpha1.Webserver, services []*corev1.Service) {
+	var pending, provisioned []string
+	for _, service := range services {
+		if service.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		var addresses []string
+		for _, ingress := range service.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				addresses = append(addresses, ingress.Hostname)
+			} else if ingress.IP != "" {
+				addresses = append(addresses, ingress.IP)
+			}
+		}
+		if len(addresses) == 0 {
+			pending = append(pending, service.Name)
+		} else {
+			provisioned = append(provisioned, fmt.Sprintf("%s at %s", service.Name, strings.Join(addresses, ", ")))
+		}
+	}
+	if len(pending) == 0 && len(provisioned) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionLoadBalancerProvisioned)
+		return
+	}
+
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionLoadBalancerProvisioned,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Provisioned",
+		Message:            "LoadBalancer Services are reachable: " + strings.Join(provisioned, "; "),
+	}
+	if len(pending) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Pending"
+		condition.Message = "No external address yet for LoadBalancer Services: " + strings.Join(pending, ", ") +
+			"; the cluster may have no load balancer provider"
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
@@ -0,0 +1,204 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	routev1 "github.com/openshift/api/route/v1"
+	"github.com/prometheus/client_golang/prometheus"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// inventoryTimeout bounds the cache reads made for each metrics scrape.
+const inventoryTimeout = 10 * time.Second
+
+var (
+	limiterWaitSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "webserver_namespace_limiter_wait_seconds",
+		Help: "Time expensive operations waited for a per-namespace concurrency slot.",
+	}, []string{"namespace"})
+
+	limiterInFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "webserver_namespace_operations_in_flight",
+		Help: "Expensive operations currently running, by Webserver namespace.",
+	}, []string{"namespace"})
+
+	reachabilityCheckSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "webserver_reachability_check_duration_seconds",
+		Help: "Duration of Webserver reachability checks.",
+	}, []string{"namespace"})
+
+	deploymentUpdates = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webserver_deployment_updates_total",
+		Help: "Reconciles of existing Deployments, by whether an update was applied or skipped as unchanged.",
+	}, []string{"result"})
+
+	circuitBreakerOpen = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "webserver_circuit_breaker_open",
+		Help: "1 while reconciles are held off after repeated API server errors, 0 otherwise.",
+	})
+
+	circuitBreakerTrips = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webserver_circuit_breaker_trips_total",
+		Help: "Number of times repeated API server errors opened the circuit breaker.",
+	})
+
+	driftedObjects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webserver_drift_detected_total",
+		Help: "Writes to owned objects held back in observe mode, by kind and the action that would have been taken.",
+	}, []string{"kind", "action"})
+
+	reconcileFastPath = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webserver_reconcile_fast_path_total",
+		Help: "Reconciles of Webservers that owned nothing yet, which create their objects without reading them first.",
+	})
+
+	routeHostChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "webserver_route_host_changes_total",
+		Help: "Times a Webserver's Route was admitted with a different host than before.",
+	}, []string{"namespace", "webserver"})
+)
+
+func init() {
+	metrics.Registry.MustRegister(limiterWaitSeconds, limiterInFlight, reachabilityCheckSeconds,
+		deploymentUpdates, circuitBreakerOpen, circuitBreakerTrips, driftedObjects, reconcileFastPath, routeHostChanges)
+}
+
+var (
+	webserversDesc = prometheus.NewDesc(
+		"webserver_webservers",
+		"Number of Webservers, by namespace and phase.",
+		[]string{"namespace", "phase"}, nil)
+
+	driftedDesc = prometheus.NewDesc(
+		"webserver_drifted_webservers",
+		"Number of Webservers in observe mode whose owned objects have drifted, by namespace.",
+		[]string{"namespace"}, nil)
+
+	readyDesc = prometheus.NewDesc(
+		"webserver_ready",
+		"1 if the Webserver is in the Ready phase, 0 otherwise.",
+		[]string{"namespace", "webserver"}, nil)
+
+	containerRestartsDesc = prometheus.NewDesc(
+		"webserver_container_restarts",
+		"Restarts of the containers in the Webserver's current pods.",
+		[]string{"namespace", "webserver"}, nil)
+
+	ownedObjectsDesc = prometheus.NewDesc(
+		"webserver_owned_objects",
+		"Number of objects managed by the operator, by owning Webserver namespace and kind.",
+		[]string{"namespace", "kind"}, nil)
+)
+
+// inventoryCollector reports how many Webservers and owned objects the
+// operator manages, and the readiness and restarts of each Webserver. It counts from the manager's cache on every scrape, so
+// the numbers are never stale and nothing has to be updated by reconciles.
+type inventoryCollector struct {
+	client client.Client
+}
+
+func newInventoryCollector(c client.Client) *inventoryCollector {
+	return &inventoryCollector{client: c}
+}
+
+func (c *inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- webserversDesc
+	ch <- driftedDesc
+	ch <- readyDesc
+	ch <- containerRestartsDesc
+	ch <- ownedObjectsDesc
+}
+
+func (c *inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), inventoryTimeout)
+	defer cancel()
+	logger := ctrl.Log.WithName("metrics")
+
+	webservers := &serversv1alpha1.WebserverList{}
+	if err := c.client.List(ctx, webservers); err != nil {
+		logger.Error(err, "Listing Webservers for metrics")
+	} else {
+		counts := map[[2]string]int{}
+		drifted := map[string]int{}
+		for i := range webservers.Items {
+			ws := &webservers.Items[i]
+			counts[[2]string{ws.Namespace, string(ws.Status.Phase)}]++
+			if meta.IsStatusConditionTrue(ws.Status.Conditions, serversv1alpha1.ConditionDrifted) {
+				drifted[ws.Namespace]++
+			}
+			ready := 0.0
+			if ws.Status.Phase == serversv1alpha1.PhaseReady {
+				ready = 1
+			}
+			ch <- prometheus.MustNewConstMetric(readyDesc, prometheus.GaugeValue, ready, ws.Namespace, ws.Name)
+			restarts := 0
+			for _, pod := range ws.Status.Pods {
+				restarts += int(pod.RestartCount)
+			}
+			ch <- prometheus.MustNewConstMetric(containerRestartsDesc, prometheus.GaugeValue, float64(restarts), ws.Namespace, ws.Name)
+		}
+		for key, n := range counts {
+			ch <- prometheus.MustNewConstMetric(webserversDesc, prometheus.GaugeValue, float64(n), key[0], key[1])
+		}
+		for namespace, n := range drifted {
+			ch <- prometheus.MustNewConstMetric(driftedDesc, prometheus.GaugeValue, float64(n), namespace)
+		}
+	}
+
+	owned := client.HasLabels{ownerNamespaceLabel}
+	lists := map[string]client.ObjectList{
+		"Deployment":  &appsv1.DeploymentList{},
+		"DaemonSet":   &appsv1.DaemonSetList{},
+		"StatefulSet": &appsv1.StatefulSetList{},
+		"Service":     &corev1.ServiceList{},
+		"Route":       &routev1.RouteList{},
+		"Ingress":     &networkingv1.IngressList{},
+		"ConfigMap":   &corev1.ConfigMapList{},
+	}
+	for kind, list := range lists {
+		if err := c.client.List(ctx, list, owned); meta.IsNoMatchError(err) {
+			continue
+		} else if err != nil {
+			logger.Error(err, "Listing owned objects for metrics", "kind", kind)
+			continue
+		}
+		objs, err := meta.ExtractList(list)
+		if err != nil {
+			continue
+		}
+		counts := map[string]int{}
+		for _, obj := range objs {
+			if o, ok := obj.(client.Object); ok {
+				counts[o.GetLabels()[ownerNamespaceLabel]]++
+			}
+		}
+		for namespace, n := range counts {
+			ch <- prometheus.MustNewConstMetric(ownedObjectsDesc, prometheus.GaugeValue, float64(n), namespace, kind)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// MigrateUnsetCount sets count: 0 on Webservers that were scaled to zero
+// before Count became optional. Those were stored without a count, which now
+// means one pod. A Webserver is migrated when it has no count, runs a
+// Deployment without a scale schedule, and its Deployment runs no replicas;
+// a Webserver created without a count since then runs one replica, so it is
+// left alone and the migration can run at every start. It must run before
+// the controller, which would otherwise scale those Deployments up first,
+// and returns the number of Webservers it migrated. SetupWithManager runs
+// it on the leader before the controller reconciles.
+func MigrateUnsetCount(ctx context.Context, c client.Client) (int, error) {
+	logger := log.FromContext(ctx)
+
+	list := &serversv1alpha1.WebserverList{}
+	if err := c.List(ctx, list); err != nil {
+		return 0, err
+	}
+	migrated := 0
+	for i := range list.Items {
+		instance := &list.Items[i]
+		workloadType := instance.Spec.WorkloadType
+		if instance.Spec.Count != nil || instance.Spec.ScaleSchedule != nil || (workloadType != "" && workloadType != serversv1alpha1.WorkloadDeployment) {
+			continue
+		}
+		deployment := &appsv1.Deployment{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: targetNamespace(instance), Name: instance.Name}, deployment); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return migrated, err
+		}
+		if deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0 {
+			continue
+		}
+
+		patch := client.MergeFrom(instance.DeepCopy())
+		zero := int32(0)
+		instance.Spec.Count = &zero
+		if err := c.Patch(ctx, instance, patch); err != nil {
+			return migrated, err
+		}
+		logger.Info("Pinned count of Webserver scaled to zero", "namespace", instance.Namespace, "name", instance.Name)
+		migrated++
+	}
+	return migrated, nil
+}
+
+// countMigration runs MigrateUnsetCount when its replica becomes the leader,
+// closing done once it has.
+type countMigration struct {
+	client client.Client
+	done   chan struct{}
+}
+
+// Start implements manager.Runnable. It runs once and returns.
+func (m *countMigration) Start(ctx context.Context) error {
+	migrated, err := MigrateUnsetCount(ctx, m.client)
+	if err != nil {
+		return fmt.Errorf("migrating Webservers scaled to zero: %w", err)
+	}
+	if migrated > 0 {
+		log.FromContext(ctx).Info("Pinned count: 0 on Webservers scaled to zero", "webservers", migrated)
+	}
+	close(m.done)
+	return nil
+}
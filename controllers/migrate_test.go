@@ -0,0 +1,84 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Count migration", func() {
+	deploymentWith := func(name string, replicas int32) *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+		}
+	}
+
+	It("pins count: 0 only on Webservers whose Deployment runs no replicas", func() {
+		ctx := context.Background()
+		scaledDown := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "scaled-down", Namespace: "default"}}
+		running := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "default"}}
+		created := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "created", Namespace: "default"}}
+		r := newFakeReconciler(scaledDown, running, created, deploymentWith("scaled-down", 0), deploymentWith("running", 1))
+
+		migrated, err := MigrateUnsetCount(ctx, r.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(Equal(1))
+
+		got := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(scaledDown), got)).To(Succeed())
+		Expect(got.Spec.Count).NotTo(BeNil())
+		Expect(*got.Spec.Count).To(BeZero())
+		for _, instance := range []*serversv1alpha1.Webserver{running, created} {
+			got := &serversv1alpha1.Webserver{}
+			Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), got)).To(Succeed())
+			Expect(got.Spec.Count).To(BeNil())
+		}
+
+		// Running it again changes nothing.
+		migrated, err = MigrateUnsetCount(ctx, r.Client)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(migrated).To(BeZero())
+	})
+
+	It("holds reconciles until the migration has run", func() {
+		ctx := context.Background()
+		instance := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		r := newFakeReconciler(instance)
+		r.setDefaults()
+		migration := &countMigration{client: r.Client, done: make(chan struct{})}
+		r.migrated = migration.done
+
+		waiting, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err := r.Reconcile(waiting, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		Expect(err).To(MatchError(context.Canceled))
+
+		Expect(migration.Start(ctx)).To(Succeed())
+		_, err = r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		Expect(err).NotTo(HaveOccurred())
+	})
+})
@@ -0,0 +1,64 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RegistryMirrors maps image prefixes, such as "registry.redhat.io", to the
+// prefix of a mirror that serves the same images, such as
+// "mirror.corp/registry.redhat.io". The manager sets it from
+// --registry-mirrors.
+var RegistryMirrors map[string]string
+
+// ParseRegistryMirrors parses a comma-separated list of source=mirror pairs.
+func ParseRegistryMirrors(value string) (map[string]string, error) {
+	mirrors := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid registry mirror %q: expected source=mirror", pair)
+		}
+		mirrors[strings.TrimSuffix(parts[0], "/")] = strings.TrimSuffix(parts[1], "/")
+	}
+	return mirrors, nil
+}
+
+// mirrorImage rewrites image to pull from the mirror with the longest
+// matching source prefix. A prefix only matches whole path components, so
+// "quay.io/org" does not match "quay.io/organization/httpd". It reports
+// whether the image was rewritten.
+func mirrorImage(image string) (string, bool) {
+	best := ""
+	for source := range RegistryMirrors {
+		if len(source) > len(best) && strings.HasPrefix(image, source) {
+			if rest := image[len(source):]; rest == "" || rest[0] == '/' || rest[0] == ':' || rest[0] == '@' {
+				best = source
+			}
+		}
+	}
+	if best == "" {
+		return image, false
+	}
+	return RegistryMirrors[best] + image[len(best):], true
+}
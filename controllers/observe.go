@@ -0,0 +1,162 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// reconcileModeAnnotation on a Webserver set to "Observe" makes the
+	// operator report drift of its owned objects instead of correcting it.
+	reconcileModeAnnotation = "servers.redhat.com/reconcile-mode"
+
+	// reconcileModeObserve is the reconcileModeAnnotation value that turns
+	// on observe mode.
+	reconcileModeObserve = "Observe"
+
+	// maxDriftDiff bounds the diff of each drifted object kept in the
+	// Drifted condition's message.
+	maxDriftDiff = 1024
+)
+
+// observing reports whether the Webserver is reconciled in observe mode.
+func (r *WebserverReconciler) observing(instance *serversv1alpha1.Webserver) bool {
+	return r.ObserveOnly || instance.Annotations[reconcileModeAnnotation] == reconcileModeObserve
+}
+
+// drift describes a write observe mode held back.
+type drift struct {
+	kind   string
+	name   string
+	action string
+	diff   string
+}
+
+// observingClient sends every write to an object other than a Webserver as
+// a server-side dry run and records it as drift, so the reconcile computes
+// exactly the changes it would make without making them. Reads and status
+// writes go through unchanged.
+type observingClient struct {
+	client.Client
+
+	mu     sync.Mutex
+	drifts []drift
+}
+
+func newObservingClient(c client.Client) *observingClient {
+	return &observingClient{Client: c}
+}
+
+// record notes a held-back write to obj, unless obj is a Webserver.
+func (c *observingClient) record(obj client.Object, action, diff string) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil || gvk.GroupKind() == serversv1alpha1.GroupVersion.WithKind("Webserver").GroupKind() {
+		return
+	}
+	if len(diff) > maxDriftDiff {
+		diff = diff[:maxDriftDiff] + "\n..."
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drifts = append(c.drifts, drift{kind: gvk.Kind, name: obj.GetName(), action: action, diff: diff})
+	driftedObjects.WithLabelValues(gvk.Kind, action).Inc()
+}
+
+func (c *observingClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	c.record(obj, "created", "")
+	return c.Client.Create(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *observingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.record(obj, "updated", c.diff(ctx, obj))
+	return c.Client.Update(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *observingClient) Patch(ctx context.Context, obj client.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.record(obj, "patched", "")
+	return c.Client.Patch(ctx, obj, patch, append(opts, client.DryRunAll)...)
+}
+
+func (c *observingClient) Delete(ctx context.Context, obj client.Object, opts ...client.DeleteOption) error {
+	c.record(obj, "deleted", "")
+	return c.Client.Delete(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+func (c *observingClient) DeleteAllOf(ctx context.Context, obj client.Object, opts ...client.DeleteAllOfOption) error {
+	c.record(obj, "deleted", "")
+	return c.Client.DeleteAllOf(ctx, obj, append(opts, client.DryRunAll)...)
+}
+
+// diff returns how obj differs from the live object it would replace.
+func (c *observingClient) diff(ctx context.Context, obj client.Object) string {
+	live, ok := obj.DeepCopyObject().(client.Object)
+	if !ok || c.Client.Get(ctx, client.ObjectKeyFromObject(obj), live) != nil {
+		return ""
+	}
+	return cmp.Diff(live, obj, cmpopts.IgnoreFields(metav1.ObjectMeta{}, "ResourceVersion", "ManagedFields"))
+}
+
+// reportDrift resets the Webserver's status to before, since none of the
+// changes it would record were made, and records in the Drifted condition
+// the writes observe mode held back.
+func (c *observingClient) reportDrift(ctx context.Context, instance *serversv1alpha1.Webserver, before *serversv1alpha1.WebserverStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	before.DeepCopyInto(&instance.Status)
+	setDriftCondition(ctx, instance, c.drifts)
+}
+
+// setDriftCondition records in the Drifted condition the writes observe mode
+// held back, and logs their diffs.
+func setDriftCondition(ctx context.Context, instance *serversv1alpha1.Webserver, drifts []drift) {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionDrifted,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "InSync",
+		Message:            "Owned objects match the Webserver",
+	}
+	if len(drifts) > 0 {
+		var lines []string
+		for _, d := range drifts {
+			log.FromContext(ctx).Info("Drift detected", "kind", d.kind, "name", d.name, "action", d.action, "diff", d.diff)
+			line := fmt.Sprintf("%s/%s would be %s", d.kind, d.name, d.action)
+			if d.diff != "" {
+				line += ":\n" + d.diff
+			}
+			lines = append(lines, line)
+		}
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "DriftDetected"
+		condition.Message = strings.Join(lines, "\n")
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
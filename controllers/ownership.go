@@ -0,0 +1,355 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// ownerNameLabel and ownerNamespaceLabel identify the Webserver that
+	// manages an object. Owner references cannot cross namespaces, so these
+	// labels are what tie objects in a target namespace back to their owner.
+	ownerNameLabel      = "servers.redhat.com/owner-name"
+	ownerNamespaceLabel = "servers.redhat.com/owner-namespace"
+
+	// adoptAnnotation set to "true" on a Webserver lets it take over
+	// existing objects with the names it would create, such as a
+	// hand-made Deployment being migrated to the operator.
+	adoptAnnotation = "servers.redhat.com/adopt"
+)
+
+// targetNamespace returns the namespace the Webserver's resources are
+// created in.
+func targetNamespace(instance *serversv1alpha1.Webserver) string {
+	if instance.Spec.TargetNamespace != "" {
+		return instance.Spec.TargetNamespace
+	}
+	return instance.Namespace
+}
+
+// addOwnerLabels marks obj as managed by the Webserver and applies the
+// recommended app.kubernetes.io labels.
+func addOwnerLabels(instance *serversv1alpha1.Webserver, obj client.Object, fieldManager string) {
+	labels := obj.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels["app.kubernetes.io/name"] = "httpd"
+	labels["app.kubernetes.io/instance"] = instance.Name
+	labels["app.kubernetes.io/component"] = "webserver"
+	labels["app.kubernetes.io/part-of"] = instance.Name
+	labels["app.kubernetes.io/managed-by"] = fieldManager
+	labels[ownerNameLabel] = instance.Name
+	labels[ownerNamespaceLabel] = instance.Namespace
+	obj.SetLabels(labels)
+}
+
+// setOwner labels a live object as managed by the Webserver. Objects in the
+// Webserver's own namespace also get a controller reference so they are
+// garbage collected with it. It is safe to call on every update: the object
+// always ends up with exactly one reference to the Webserver.
+func (r *WebserverReconciler) setOwner(instance *serversv1alpha1.Webserver, obj client.Object) error {
+	if obj.GetResourceVersion() != "" {
+		if err := r.checkAdoptable(instance, obj); err != nil {
+			return err
+		}
+	}
+	addOwnerLabels(instance, obj, r.fieldManager())
+	if obj.GetNamespace() != instance.Namespace {
+		return nil
+	}
+
+	// SetControllerReference only replaces the first matching reference, so
+	// drop duplicates left by manual edits or by an earlier Webserver of the
+	// same name before adding ours back.
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if !refersToWebserver(ref, instance) {
+			refs = append(refs, ref)
+		}
+	}
+	obj.SetOwnerReferences(refs)
+	return controllerutil.SetControllerReference(instance, obj, r.Scheme)
+}
+
+// checkAdoptable returns an error unless the existing object obj is already
+// managed by the Webserver, or is unmanaged and the Webserver asks to adopt
+// it. Objects controlled by anything else are never taken over.
+func (r *WebserverReconciler) checkAdoptable(instance *serversv1alpha1.Webserver, obj client.Object) error {
+	labels := obj.GetLabels()
+	if labels[ownerNameLabel] == instance.Name && labels[ownerNamespaceLabel] == instance.Namespace {
+		return nil
+	}
+	kind := "Object"
+	if gvk, err := apiutil.GVKForObject(obj, r.Scheme); err == nil {
+		kind = gvk.Kind
+	}
+	if ref := metav1.GetControllerOf(obj); ref != nil {
+		if refersToWebserver(*ref, instance) {
+			return nil
+		}
+		return fmt.Errorf("%s %s/%s is already controlled by %s %s", kind, obj.GetNamespace(), obj.GetName(), ref.Kind, ref.Name)
+	}
+	if labels[ownerNameLabel] != "" {
+		return fmt.Errorf("%s %s/%s is already managed by Webserver %s/%s", kind, obj.GetNamespace(), obj.GetName(), labels[ownerNamespaceLabel], labels[ownerNameLabel])
+	}
+	if instance.Annotations[adoptAnnotation] != "true" {
+		return fmt.Errorf("%s %s/%s already exists and is not managed by the operator; annotate the Webserver with %s=true to adopt it",
+			kind, obj.GetNamespace(), obj.GetName(), adoptAnnotation)
+	}
+	return nil
+}
+
+// refersToWebserver reports whether ref points at a Webserver with the
+// instance's name, regardless of UID.
+func refersToWebserver(ref metav1.OwnerReference, instance *serversv1alpha1.Webserver) bool {
+	gv, err := schema.ParseGroupVersion(ref.APIVersion)
+	return err == nil &&
+		gv.Group == serversv1alpha1.GroupVersion.Group &&
+		ref.Kind == "Webserver" &&
+		ref.Name == instance.Name
+}
+
+// fieldManager returns the name the operator writes and labels objects
+// under.
+func (r *WebserverReconciler) fieldManager() string {
+	if r.FieldManager != "" {
+		return r.FieldManager
+	}
+	return DefaultFieldManager
+}
+
+// deleteOwnedObjects removes the Deployment, DaemonSet, StatefulSet,
+// Services, Route, HTTPRoute, Ingress, ConfigMaps and PrometheusRule the
+// Webserver manages in namespace, and the objects its ResourceBuilders
+// added there. Objects that are already gone are ignored.
+func (r *WebserverReconciler) deleteOwnedObjects(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string) error {
+	opts := []client.ListOption{
+		client.InNamespace(namespace),
+		client.MatchingLabels{
+			ownerNameLabel:      instance.Name,
+			ownerNamespaceLabel: instance.Namespace,
+		},
+	}
+
+	var objs []client.Object
+	deployments := &appsv1.DeploymentList{}
+	if err := r.Client.List(ctx, deployments, opts...); err != nil {
+		return err
+	}
+	for i := range deployments.Items {
+		objs = append(objs, &deployments.Items[i])
+	}
+	daemonSets := &appsv1.DaemonSetList{}
+	if err := r.Client.List(ctx, daemonSets, opts...); err != nil {
+		return err
+	}
+	for i := range daemonSets.Items {
+		objs = append(objs, &daemonSets.Items[i])
+	}
+	statefulSets := &appsv1.StatefulSetList{}
+	if err := r.Client.List(ctx, statefulSets, opts...); err != nil {
+		return err
+	}
+	for i := range statefulSets.Items {
+		objs = append(objs, &statefulSets.Items[i])
+	}
+	services := &corev1.ServiceList{}
+	if err := r.Client.List(ctx, services, opts...); err != nil {
+		return err
+	}
+	for i := range services.Items {
+		objs = append(objs, &services.Items[i])
+	}
+	routes := &routev1.RouteList{}
+	if err := r.Client.List(ctx, routes, opts...); err != nil && !meta.IsNoMatchError(err) {
+		return err
+	}
+	for i := range routes.Items {
+		objs = append(objs, &routes.Items[i])
+	}
+	httpRoutes := &unstructured.UnstructuredList{}
+	httpRoutes.SetGroupVersionKind(httpRouteGVK.GroupVersion().WithKind(httpRouteGVK.Kind + "List"))
+	if err := r.Client.List(ctx, httpRoutes, opts...); err != nil && !meta.IsNoMatchError(err) {
+		return err
+	}
+	for i := range httpRoutes.Items {
+		objs = append(objs, &httpRoutes.Items[i])
+	}
+	ingresses := &networkingv1.IngressList{}
+	if err := r.Client.List(ctx, ingresses, opts...); err != nil {
+		return err
+	}
+	for i := range ingresses.Items {
+		objs = append(objs, &ingresses.Items[i])
+	}
+	configMaps := &corev1.ConfigMapList{}
+	if err := r.Client.List(ctx, configMaps, opts...); err != nil {
+		return err
+	}
+	for i := range configMaps.Items {
+		objs = append(objs, &configMaps.Items[i])
+	}
+	rules := &unstructured.UnstructuredList{}
+	rules.SetGroupVersionKind(prometheusRuleGVK.GroupVersion().WithKind(prometheusRuleGVK.Kind + "List"))
+	if err := r.Client.List(ctx, rules, opts...); err != nil && !meta.IsNoMatchError(err) {
+		return err
+	}
+	for i := range rules.Items {
+		objs = append(objs, &rules.Items[i])
+	}
+	// The kinds ResourceBuilders add are only known by rendering.
+	logger := log.FromContext(ctx)
+	desired, err := r.buildManifests(instance)
+	if err != nil {
+		logger.Error(err, "Cannot render the Webserver to find the objects resource builders added")
+		desired = &manifests{}
+	}
+	listed := map[schema.GroupVersionKind]bool{}
+	for _, extra := range desired.Extra {
+		gvk := extra.GroupVersionKind()
+		if listed[gvk] {
+			continue
+		}
+		listed[gvk] = true
+		list := &unstructured.UnstructuredList{}
+		list.SetGroupVersionKind(gvk.GroupVersion().WithKind(gvk.Kind + "List"))
+		err := r.Client.List(ctx, list,
+			client.InNamespace(namespace),
+			client.MatchingLabels{
+				ownerNameLabel:      instance.Name,
+				ownerNamespaceLabel: instance.Namespace,
+				builderLabel:        "true",
+			})
+		if err != nil && !meta.IsNoMatchError(err) {
+			return err
+		}
+		for i := range list.Items {
+			objs = append(objs, &list.Items[i])
+		}
+	}
+
+	for _, obj := range objs {
+		logger.V(1).Info("Deleting owned object", "namespace", namespace, "name", obj.GetName())
+		if err := r.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOwnedExcept deletes the objects of list's kind that the Webserver
+// manages in namespace, other than the one named keep and those a
+// ResourceBuilder added. Kinds the cluster does not serve are ignored.
+func (r *WebserverReconciler) deleteOwnedExcept(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string, list client.ObjectList, keep string) error {
+	if r.creating {
+		return nil
+	}
+	err := r.Client.List(ctx, list,
+		client.InNamespace(namespace),
+		client.MatchingLabels{
+			ownerNameLabel:      instance.Name,
+			ownerNamespaceLabel: instance.Namespace,
+		})
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	objs, err := meta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, o := range objs {
+		obj, ok := o.(client.Object)
+		if !ok || obj.GetName() == keep || addedByBuilder(obj) {
+			continue
+		}
+		log.FromContext(ctx).V(1).Info("Deleting object no longer used", "namespace", namespace, "name", obj.GetName())
+		if err := r.Client.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteOtherWorkloads deletes the Deployments, DaemonSets and
+// StatefulSets the Webserver manages in namespace that are not of the
+// WorkloadType it runs now, left from before it was switched, and clears
+// their status.
+func (r *WebserverReconciler) deleteOtherWorkloads(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string) error {
+	current := instance.Spec.WorkloadType
+	if current == "" {
+		current = serversv1alpha1.WorkloadDeployment
+	}
+	workloads := []struct {
+		workloadType serversv1alpha1.WorkloadType
+		list         client.ObjectList
+		condition    string
+		status       *serversv1alpha1.ResourceStatus
+	}{
+		{serversv1alpha1.WorkloadDeployment, &appsv1.DeploymentList{}, serversv1alpha1.ConditionDeploymentApplied, &instance.Status.Resources.Deployment},
+		{serversv1alpha1.WorkloadDaemonSet, &appsv1.DaemonSetList{}, serversv1alpha1.ConditionDaemonSetApplied, &instance.Status.Resources.DaemonSet},
+		{serversv1alpha1.WorkloadStatefulSet, &appsv1.StatefulSetList{}, serversv1alpha1.ConditionStatefulSetApplied, &instance.Status.Resources.StatefulSet},
+	}
+	for _, workload := range workloads {
+		if workload.workloadType == current {
+			continue
+		}
+		if err := r.deleteOwnedExcept(ctx, instance, namespace, workload.list, ""); err != nil {
+			return err
+		}
+		meta.RemoveStatusCondition(&instance.Status.Conditions, workload.condition)
+		*workload.status = serversv1alpha1.ResourceStatus{}
+	}
+	if current != serversv1alpha1.WorkloadDeployment {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionSelectorUpToDate)
+	}
+	return nil
+}
+
+// ownerFromLabels maps an object carrying owner labels back to a reconcile
+// request for its Webserver.
+func ownerFromLabels(obj client.Object) []ctrl.Request {
+	labels := obj.GetLabels()
+	name, namespace := labels[ownerNameLabel], labels[ownerNamespaceLabel]
+	if name == "" || namespace == "" {
+		return nil
+	}
+	return []ctrl.Request{{NamespacedName: types.NamespacedName{Name: name, Namespace: namespace}}}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// newFakeReconciler returns a reconciler backed by a fake client holding
+// objs.
+func newFakeReconciler(objs ...client.Object) *WebserverReconciler {
+	s := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(s))
+	utilruntime.Must(routev1.AddToScheme(s))
+	utilruntime.Must(serversv1alpha1.AddToScheme(s))
+	return &WebserverReconciler{
+		Client: fake.NewClientBuilder().WithScheme(s).WithObjects(objs...).Build(),
+		Scheme: s,
+	}
+}
+
+// controllerRefs returns the controller references on obj.
+func controllerRefs(obj client.Object) []metav1.OwnerReference {
+	var refs []metav1.OwnerReference
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.Controller != nil && *ref.Controller {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+var _ = Describe("Owner references", func() {
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+		desired  *manifests
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		count := int32(1)
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-current"},
+			Spec:       serversv1alpha1.WebserverSpec{Count: &count},
+		}
+		r = newFakeReconciler(instance)
+
+		var err error
+		desired, err = renderManifests(instance, DefaultFieldManager)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("keeps a single controller reference when the Deployment is reapplied", func() {
+		for i := 0; i < 3; i++ {
+			_, err := r.reconcileDeployment(ctx, instance, desired.Deployment)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		deployment := &appsv1.Deployment{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Deployment), deployment)).To(Succeed())
+		refs := controllerRefs(deployment)
+		Expect(refs).To(HaveLen(1))
+		Expect(refs[0].UID).To(BeEquivalentTo("uid-current"))
+	})
+
+	It("removes duplicate and stale references left by manual edits", func() {
+		_, err := r.reconcileDeployment(ctx, instance, desired.Deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		deployment := &appsv1.Deployment{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Deployment), deployment)).To(Succeed())
+		isController := false
+		deployment.OwnerReferences = append(deployment.OwnerReferences,
+			deployment.OwnerReferences[0],
+			metav1.OwnerReference{
+				APIVersion: serversv1alpha1.GroupVersion.String(),
+				Kind:       "Webserver",
+				Name:       instance.Name,
+				UID:        "uid-stale",
+				Controller: &isController,
+			})
+		Expect(r.Client.Update(ctx, deployment)).To(Succeed())
+
+		_, err = r.reconcileDeployment(ctx, instance, desired.Deployment)
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Deployment), deployment)).To(Succeed())
+		Expect(deployment.OwnerReferences).To(HaveLen(1))
+		Expect(controllerRefs(deployment)).To(HaveLen(1))
+		Expect(deployment.OwnerReferences[0].UID).To(BeEquivalentTo("uid-current"))
+	})
+
+	It("restores the controller reference on an existing Route", func() {
+		route := desired.Route.DeepCopy()
+		Expect(r.Client.Create(ctx, route)).To(Succeed())
+		Expect(controllerRefs(route)).To(BeEmpty())
+
+		for i := 0; i < 2; i++ {
+			_, err := r.reconcileRoute(ctx, instance, desired.Route)
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		refs := controllerRefs(route)
+		Expect(refs).To(HaveLen(1))
+		Expect(refs[0].UID).To(BeEquivalentTo("uid-current"))
+	})
+})
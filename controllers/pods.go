@@ -0,0 +1,239 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// crashLoopBackOffReason is the container waiting reason the kubelet
+	// reports while backing off restarts of a crashing container.
+	crashLoopBackOffReason = "CrashLoopBackOff"
+
+	// maxStatusPods caps the number of pods listed in a Webserver's status.
+	maxStatusPods = 25
+
+	// crashLoopInitialBackoff and crashLoopMaxBackoff bound how long the
+	// operator waits before looking at crash looping pods again, mirroring
+	// the kubelet's restart backoff.
+	crashLoopInitialBackoff = 10 * time.Second
+	crashLoopMaxBackoff     = 5 * time.Minute
+)
+
+// listPods returns the pods in namespace matching the given labels.
+func (r *WebserverReconciler) listPods(ctx context.Context, namespace string, labels map[string]string) ([]corev1.Pod, error) {
+	list := &corev1.PodList{}
+	err := r.Client.List(ctx, list, client.InNamespace(namespace), client.MatchingLabels(labels))
+	if err != nil {
+		return nil, err
+	}
+	return list.Items, nil
+}
+
+// podSummary describes the readiness of pods in a form such as
+// "3/5 ready, 1 pending, 1 crashloop". Zero pending and crashloop counts are
+// left out.
+func podSummary(pods []corev1.Pod) string {
+	var ready, pending, crashloop int
+	for i := range pods {
+		pod := &pods[i]
+		switch {
+		case podCrashLooping(pod):
+			crashloop++
+		case podReady(pod):
+			ready++
+		case pod.Status.Phase == corev1.PodPending:
+			pending++
+		}
+	}
+
+	parts := []string{fmt.Sprintf("%d/%d ready", ready, len(pods))}
+	if pending > 0 {
+		parts = append(parts, fmt.Sprintf("%d pending", pending))
+	}
+	if crashloop > 0 {
+		parts = append(parts, fmt.Sprintf("%d crashloop", crashloop))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// podInfos returns the name, phase and restart count of up to maxStatusPods
+// pods, sorted by name.
+func podInfos(pods []corev1.Pod) []serversv1alpha1.PodInfo {
+	if len(pods) == 0 {
+		return nil
+	}
+	infos := make([]serversv1alpha1.PodInfo, 0, len(pods))
+	for i := range pods {
+		pod := &pods[i]
+		info := serversv1alpha1.PodInfo{Name: pod.Name, Phase: pod.Status.Phase}
+		for _, cs := range pod.Status.ContainerStatuses {
+			info.RestartCount += cs.RestartCount
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	if len(infos) > maxStatusPods {
+		infos = infos[:maxStatusPods]
+	}
+	return infos
+}
+
+// runningImageID returns the image ID of the webserver container in the
+// first ready pod, by name, or "" if no pod is ready.
+func runningImageID(pods []corev1.Pod) string {
+	var name, imageID string
+	for i := range pods {
+		pod := &pods[i]
+		if !podReady(pod) || (name != "" && pod.Name > name) {
+			continue
+		}
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.Name == webserverContainerName && cs.ImageID != "" {
+				name, imageID = pod.Name, cs.ImageID
+			}
+		}
+	}
+	return imageID
+}
+
+// webserverForPod maps a pod to a reconcile request for the Webserver whose
+// workload runs it, following a Deployment's pod through its ReplicaSet.
+func (r *WebserverReconciler) webserverForPod(obj client.Object) []ctrl.Request {
+	ctx := context.Background()
+
+	owner := metav1.GetControllerOf(obj)
+	if owner == nil {
+		return nil
+	}
+	var workload client.Object
+	switch owner.Kind {
+	case "DaemonSet":
+		workload = &appsv1.DaemonSet{}
+	case "StatefulSet":
+		workload = &appsv1.StatefulSet{}
+	}
+	if workload != nil {
+		if err := r.Client.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: obj.GetNamespace()}, workload); err != nil {
+			return nil
+		}
+		return ownerFromLabels(workload)
+	}
+	if owner.Kind != "ReplicaSet" {
+		return nil
+	}
+	rs := &appsv1.ReplicaSet{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: obj.GetNamespace()}, rs); err != nil {
+		return nil
+	}
+
+	owner = metav1.GetControllerOf(rs)
+	if owner == nil || owner.Kind != "Deployment" {
+		return nil
+	}
+	deployment := &appsv1.Deployment{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: owner.Name, Namespace: obj.GetNamespace()}, deployment); err != nil {
+		return nil
+	}
+	return ownerFromLabels(deployment)
+}
+
+// crashLoopRequeue returns how long to back off before the next reconcile
+// while pods are crash looping, and zero otherwise.
+func crashLoopRequeue(ctx context.Context, pods []corev1.Pod) time.Duration {
+	message, restarts, ok := crashLoop(pods)
+	if !ok {
+		return 0
+	}
+	backoff := crashLoopBackoff(restarts)
+	log.FromContext(ctx).V(1).Info("Pods are crash looping, backing off", "reason", message, "requeueAfter", backoff)
+	return backoff
+}
+
+// crashLoop describes the first crash looping container found in pods, or
+// returns ok=false if none is crash looping.
+func crashLoop(pods []corev1.Pod) (message string, restarts int32, ok bool) {
+	for i := range pods {
+		pod := &pods[i]
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.State.Waiting == nil || cs.State.Waiting.Reason != crashLoopBackOffReason {
+				continue
+			}
+			message = fmt.Sprintf("container %s in pod %s is crash looping", cs.Name, pod.Name)
+			if t := cs.LastTerminationState.Terminated; t != nil {
+				message += fmt.Sprintf(": exit code %d", t.ExitCode)
+				if t.Reason != "" {
+					message += ", " + t.Reason
+				}
+				if t.Message != "" {
+					message += ": " + strings.TrimSpace(t.Message)
+				}
+			}
+			return message, cs.RestartCount, true
+		}
+	}
+	return "", 0, false
+}
+
+// crashLoopBackoff returns how long to wait before reconciling a Webserver
+// whose container has restarted the given number of times.
+func crashLoopBackoff(restarts int32) time.Duration {
+	backoff := crashLoopInitialBackoff
+	for i := int32(1); i < restarts && backoff < crashLoopMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > crashLoopMaxBackoff {
+		backoff = crashLoopMaxBackoff
+	}
+	return backoff
+}
+
+// podReady reports whether the pod's Ready condition is true.
+func podReady(pod *corev1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == corev1.PodReady {
+			return c.Status == corev1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// podCrashLooping reports whether any container in the pod is backing off
+// after repeated crashes.
+func podCrashLooping(pod *corev1.Pod) bool {
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.State.Waiting != nil && cs.State.Waiting.Reason == crashLoopBackOffReason {
+			return true
+		}
+	}
+	return false
+}
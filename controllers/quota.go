@@ -0,0 +1,94 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// exceededQuotaMessage starts the part of a quota admission error that
+// names the ResourceQuota, as in "exceeded quota: compute, requested: ...".
+const exceededQuotaMessage = "exceeded quota: "
+
+// quotaFailure returns the message and ResourceQuota name of the first
+// failure caused by a ResourceQuota: either a write among errs that the API
+// server rejected, or the Deployment being unable to create pods.
+func quotaFailure(deployment *appsv1.Deployment, errs []error) (message, quota string, ok bool) {
+	var flat []error
+	if agg := utilerrors.Flatten(utilerrors.NewAggregate(errs)); agg != nil {
+		flat = agg.Errors()
+	}
+	for _, err := range flat {
+		if errors.IsForbidden(err) {
+			if quota, ok := quotaName(err.Error()); ok {
+				return err.Error(), quota, true
+			}
+		}
+	}
+	if deployment != nil {
+		for _, condition := range deployment.Status.Conditions {
+			if condition.Type == appsv1.DeploymentReplicaFailure && condition.Status == corev1.ConditionTrue {
+				if quota, ok := quotaName(condition.Message); ok {
+					return condition.Message, quota, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// quotaName extracts the ResourceQuota name from a quota admission error.
+func quotaName(message string) (string, bool) {
+	i := strings.Index(message, exceededQuotaMessage)
+	if i < 0 {
+		return "", false
+	}
+	name := message[i+len(exceededQuotaMessage):]
+	if j := strings.IndexAny(name, ", "); j >= 0 {
+		name = name[:j]
+	}
+	return name, true
+}
+
+// setQuotaCondition records in the QuotaExceeded condition whether a
+// ResourceQuota is blocking the Webserver's objects or pods, and emits a
+// Warning event naming the quota when one is.
+func (r *WebserverReconciler) setQuotaCondition(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment, errs []error) {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionQuotaExceeded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "WithinQuota",
+	}
+	if message, quota, ok := quotaFailure(deployment, errs); ok {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ExceededQuota"
+		condition.Message = "ResourceQuota " + quota + " blocks the Webserver: " + message
+		r.event(ctx, instance, corev1.EventTypeWarning, "QuotaExceeded", "ResourceQuota %s blocks the Webserver: %s", quota, message)
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
@@ -0,0 +1,135 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// skipReachabilityAnnotation set to "true" on a Webserver disables its
+// reachability check, for Webservers the operator should not send requests
+// to. Their Reachable condition is removed.
+const skipReachabilityAnnotation = "servers.redhat.com/skip-reachability"
+
+// checkReachability runs the Webserver's reachability check against the
+// Service and records the outcome in the Reachable condition. The check
+// only runs once its period has passed since the last one for the current
+// generation; until then it returns the time remaining. Otherwise it
+// returns how long to wait before the next check, or zero when the check is
+// disabled.
+//
+// The request goes to the Service's cluster DNS name, so the check only
+// works when the operator runs inside the cluster.
+func (r *WebserverReconciler) checkReachability(ctx context.Context, instance *serversv1alpha1.Webserver, service *corev1.Service, now time.Time) time.Duration {
+	check := instance.Spec.ReachabilityCheck
+	// A skipped check reports nothing rather than an Unknown outcome, as
+	// if it were not configured.
+	if check == nil || instance.Annotations[skipReachabilityAnnotation] == "true" {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionReachable)
+		instance.Status.LastReachabilityCheck = nil
+		return 0
+	}
+
+	path := check.Path
+	if path == "" {
+		path = "/"
+	}
+	expected := int(check.ExpectedStatus)
+	if expected == 0 {
+		expected = http.StatusOK
+	}
+	timeout := time.Duration(check.TimeoutSeconds) * time.Second
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	period := time.Duration(check.PeriodSeconds) * time.Second
+	if period <= 0 {
+		period = time.Minute
+	}
+	// Pod changes reconcile the Webserver far more often than the period,
+	// and each check can hold a worker for the whole timeout.
+	if last := instance.Status.LastReachabilityCheck; last != nil {
+		current := meta.FindStatusCondition(instance.Status.Conditions, serversv1alpha1.ConditionReachable)
+		if current != nil && current.ObservedGeneration == instance.Generation {
+			if remaining := last.Add(period).Sub(now); remaining > 0 {
+				return remaining
+			}
+		}
+	}
+
+	url := fmt.Sprintf("http://%s.%s.svc:%d%s", service.Name, service.Namespace, service.Spec.Ports[0].Port, path)
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionReachable,
+		ObservedGeneration: instance.Generation,
+	}
+
+	release, err := r.checks.acquire(ctx, instance.Namespace)
+	if err != nil {
+		return period
+	}
+	start := time.Now()
+	code, err := httpGet(ctx, url, timeout)
+	reachabilityCheckSeconds.WithLabelValues(instance.Namespace).Observe(time.Since(start).Seconds())
+	release()
+
+	switch {
+	case err != nil:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "RequestFailed"
+		condition.Message = err.Error()
+	case code != expected:
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "UnexpectedStatus"
+		condition.Message = fmt.Sprintf("GET %s returned %d, expected %d", url, code, expected)
+	default:
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ExpectedStatus"
+		condition.Message = fmt.Sprintf("GET %s returned %d", url, code)
+	}
+	log.FromContext(ctx).V(1).Info("Checked reachability", "url", url, "reachable", condition.Status)
+
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	instance.Status.LastReachabilityCheck = &metav1.Time{Time: now}
+	return period
+}
+
+// httpGet requests url and returns the response status code.
+func httpGet(ctx context.Context, url string, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Reachability checks", func() {
+	It("waits out the period instead of checking on every reconcile", func() {
+		now := time.Date(2026, time.January, 15, 12, 0, 0, 0, time.UTC)
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 2},
+			Spec: serversv1alpha1.WebserverSpec{
+				ReachabilityCheck: &serversv1alpha1.ReachabilityCheck{PeriodSeconds: 60},
+			},
+		}
+		instance.Status.LastReachabilityCheck = &metav1.Time{Time: now.Add(-20 * time.Second)}
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionReachable,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: 2,
+			Reason:             "ExpectedStatus",
+		})
+		service := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Port: 8080}}},
+		}
+		r := newFakeReconciler(instance)
+
+		Expect(r.checkReachability(context.Background(), instance, service, now)).To(Equal(40 * time.Second))
+		Expect(instance.Status.LastReachabilityCheck.Time).To(Equal(now.Add(-20 * time.Second)))
+		Expect(meta.IsStatusConditionTrue(instance.Status.Conditions, serversv1alpha1.ConditionReachable)).To(BeTrue())
+	})
+})
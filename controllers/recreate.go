@@ -0,0 +1,198 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// recreateDelayAnnotation on a Webserver overrides the reconciler's
+// RecreateDelay for its objects, as a Go duration such as "10m".
+const recreateDelayAnnotation = "servers.redhat.com/recreate-delay"
+
+// recreateHolds remembers when each owned object was first found deleted
+// by someone other than the operator, so that recreating it can be held off
+// for the recreate delay. It is kept in memory: after a restart the delay
+// starts over.
+type recreateHolds struct {
+	mu           sync.Mutex
+	missingSince map[types.NamespacedName]map[string]time.Time
+}
+
+func newRecreateHolds() *recreateHolds {
+	return &recreateHolds{missingSince: map[types.NamespacedName]map[string]time.Time{}}
+}
+
+// missing records that the Webserver's object key is missing at now and
+// returns when it was first found missing.
+func (h *recreateHolds) missing(webserver types.NamespacedName, key string, now time.Time) time.Time {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	objects := h.missingSince[webserver]
+	if objects == nil {
+		objects = map[string]time.Time{}
+		h.missingSince[webserver] = objects
+	}
+	if since, ok := objects[key]; ok {
+		return since
+	}
+	objects[key] = now
+	return now
+}
+
+// release drops the Webserver's object key once it exists again or is
+// about to be recreated.
+func (h *recreateHolds) release(webserver types.NamespacedName, key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.missingSince[webserver], key)
+	if len(h.missingSince[webserver]) == 0 {
+		delete(h.missingSince, webserver)
+	}
+}
+
+// forget drops the bookkeeping for a Webserver that no longer exists.
+func (h *recreateHolds) forget(webserver types.NamespacedName) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.missingSince, webserver)
+}
+
+// recreateDelay returns how long the Webserver's owned objects stay deleted
+// before they are recreated: its recreateDelayAnnotation, or else the
+// reconciler's RecreateDelay.
+func (r *WebserverReconciler) recreateDelay(ctx context.Context, instance *serversv1alpha1.Webserver) time.Duration {
+	if value, ok := instance.Annotations[recreateDelayAnnotation]; ok {
+		d, err := time.ParseDuration(value)
+		if err == nil && d >= 0 {
+			return d
+		}
+		log.FromContext(ctx).Info("Ignoring invalid recreate delay annotation", "value", value)
+	}
+	return r.RecreateDelay
+}
+
+// holdDeletedObjects leaves out of desired the Services, Route, HTTPRoute
+// and Ingress that the operator applied before but someone else deleted
+// less than the recreate delay ago, giving admins a window for
+// maintenance. The held objects are listed in the RecreateHeld condition.
+// It returns how long until the first of them may be recreated, or zero
+// when none is held. The Deployment is always recreated straight away, as
+// the Webserver cannot serve without it.
+func (r *WebserverReconciler) holdDeletedObjects(ctx context.Context, instance *serversv1alpha1.Webserver, desired *manifests, now time.Time) (time.Duration, error) {
+	delay := r.recreateDelay(ctx, instance)
+	if delay <= 0 || r.holds == nil || len(instance.Status.Objects) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionRecreateHeld)
+		return 0, nil
+	}
+	webserver := client.ObjectKeyFromObject(instance)
+
+	// held reports whether obj, of the given kind, was deleted outside the
+	// operator less than the delay ago, and how long remains.
+	var messages []string
+	var after time.Duration
+	held := func(kind string, obj client.Object) (bool, error) {
+		key := kind + "/" + obj.GetName()
+		if action, ok := instance.Status.Objects[key]; !ok || action.Action == serversv1alpha1.ActionFailed {
+			return false, nil
+		}
+		live := obj.DeepCopyObject().(client.Object)
+		err := r.Client.Get(ctx, client.ObjectKeyFromObject(obj), live)
+		if err == nil || !errors.IsNotFound(err) {
+			r.holds.release(webserver, key)
+			return false, client.IgnoreNotFound(err)
+		}
+		recreateAt := r.holds.missing(webserver, key, now).Add(delay)
+		remaining := recreateAt.Sub(now)
+		if remaining <= 0 {
+			log.FromContext(ctx).Info("Recreating deleted object", "object", key)
+			r.holds.release(webserver, key)
+			return false, nil
+		}
+		log.FromContext(ctx).Info("Holding off recreating deleted object", "object", key, "remaining", remaining.Round(time.Second))
+		// The time, not the remaining duration, keeps the condition from
+		// changing, and the status from being written, on every reconcile.
+		messages = append(messages, fmt.Sprintf("%s at %s", key, recreateAt.UTC().Format(time.RFC3339)))
+		if after == 0 || remaining < after {
+			after = remaining
+		}
+		return true, nil
+	}
+
+	services := desired.Services[:0:0]
+	for _, service := range desired.Services {
+		if ok, err := held("Service", service); err != nil {
+			return 0, err
+		} else if !ok {
+			services = append(services, service)
+		}
+	}
+	desired.Services = services
+	if desired.Route != nil {
+		if ok, err := held("Route", desired.Route); err != nil {
+			return 0, err
+		} else if ok {
+			desired.Route = nil
+			desired.RouteHeld = true
+		}
+	}
+	if desired.HTTPRoute != nil {
+		if ok, err := held("HTTPRoute", desired.HTTPRoute); err != nil {
+			return 0, err
+		} else if ok {
+			desired.HTTPRoute = nil
+		}
+	}
+	if desired.Ingress != nil {
+		if ok, err := held("Ingress", desired.Ingress); err != nil {
+			return 0, err
+		} else if ok {
+			desired.Ingress = nil
+		}
+	}
+
+	if len(messages) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionRecreateHeld)
+		return 0, nil
+	}
+	sort.Strings(messages)
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               serversv1alpha1.ConditionRecreateHeld,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "DeletedExternally",
+		Message:            "Deleted outside the operator; recreating " + strings.Join(messages, ", "),
+	})
+	return after, nil
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// ReconcileReport describes what one reconcile of a Webserver did. It is
+// passed to the reconciler's OnReconcile hook, so tests can assert on the
+// writes a reconcile made without inspecting the cluster.
+type ReconcileReport struct {
+	// Request is the reconciled Webserver.
+	Request ctrl.Request
+	// Objects lists the owned objects the reconcile applied, in the order
+	// it applied them.
+	Objects []ObjectReport
+	// Result and Err are what Reconcile returned.
+	Result ctrl.Result
+	Err    error
+}
+
+// ObjectReport describes what a reconcile did to one owned object.
+type ObjectReport struct {
+	Kind   string
+	Name   string
+	Action serversv1alpha1.ReconcileAction
+	// Err is the error applying the object, when Action is Failed.
+	Err error
+}
+
+// Changed returns the objects the reconcile created or updated.
+func (r *ReconcileReport) Changed() []ObjectReport {
+	var changed []ObjectReport
+	for _, object := range r.Objects {
+		if object.Action == serversv1alpha1.ActionCreated || object.Action == serversv1alpha1.ActionUpdated {
+			changed = append(changed, object)
+		}
+	}
+	return changed
+}
+
+// Object returns the report for the owned object kind/name, if the
+// reconcile applied it.
+func (r *ReconcileReport) Object(kind, name string) (ObjectReport, bool) {
+	for _, object := range r.Objects {
+		if object.Kind == kind && object.Name == name {
+			return object, true
+		}
+	}
+	return ObjectReport{}, false
+}
+
+type reportKey struct{}
+
+// withReport returns a context that collects the actions of a reconcile
+// into report.
+func withReport(ctx context.Context, report *ReconcileReport) context.Context {
+	return context.WithValue(ctx, reportKey{}, report)
+}
+
+// reportObject adds an object's action to the reconcile's report, if the
+// context carries one.
+func reportObject(ctx context.Context, object ObjectReport) {
+	if report, ok := ctx.Value(reportKey{}).(*ReconcileReport); ok {
+		report.Objects = append(report.Objects, object)
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Reconcile reports", func() {
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+		reports  []ReconcileReport
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		count := int32(1)
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec:       serversv1alpha1.WebserverSpec{Count: &count},
+		}
+		r = newFakeReconciler(instance)
+		reports = nil
+		r.OnReconcile = func(report ReconcileReport) { reports = append(reports, report) }
+		r.setDefaults()
+	})
+
+	It("reports the objects each reconcile changed", func() {
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reports).To(HaveLen(1))
+		Expect(reports[0].Request).To(Equal(req))
+		deployment, ok := reports[0].Object("Deployment", "web")
+		Expect(ok).To(BeTrue())
+		Expect(deployment.Action).To(Equal(serversv1alpha1.ActionCreated))
+
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reports).To(HaveLen(2))
+		Expect(reports[1].Objects).NotTo(BeEmpty())
+		Expect(reports[1].Changed()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,220 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// ResourceBuilder renders objects a Webserver owns. Builders run in order,
+// each receiving the objects rendered so far. A builder may change those
+// objects in place and returns them with any objects it adds.
+//
+// The reconciler applies the built-in objects as usual, with the builders'
+// changes. It creates or updates each added object, copying every
+// top-level field other than metadata and status, and labels and owns it
+// like the built-in ones, and deletes it with them when the Webserver is
+// deleted or moves to another target namespace. Built-in objects cannot be
+// removed. Added objects a builder stops returning are otherwise left in
+// place.
+type ResourceBuilder interface {
+	Build(instance *serversv1alpha1.Webserver, objs []client.Object) ([]client.Object, error)
+}
+
+// builderLabel marks the objects a ResourceBuilder added. The cleanup of
+// the built-in objects a Webserver no longer needs skips them, so a
+// builder may add objects of the same kinds, such as a ConfigMap.
+const builderLabel = "servers.redhat.com/resource-builder"
+
+// DefaultResourceBuilder renders the built-in objects, as RenderManifests
+// does. It runs first unless the registered builders include it, in which
+// case the builders before it see no objects.
+type DefaultResourceBuilder struct{}
+
+// Build implements ResourceBuilder.
+func (DefaultResourceBuilder) Build(instance *serversv1alpha1.Webserver, objs []client.Object) ([]client.Object, error) {
+	m, err := previewManifests(instance)
+	if err != nil {
+		return nil, err
+	}
+	return append(objs, m.objects()...), nil
+}
+
+// isDefaultBuilder reports whether builder is a DefaultResourceBuilder.
+func isDefaultBuilder(builder ResourceBuilder) bool {
+	switch builder.(type) {
+	case DefaultResourceBuilder, *DefaultResourceBuilder:
+		return true
+	}
+	return false
+}
+
+// runBuilders runs the builder chain: builders, with a
+// DefaultResourceBuilder first unless they include one. At the
+// DefaultResourceBuilder's place render supplies the built-in objects
+// instead, which runBuilders returns typed. The objects the other builders
+// add are returned separately, in the target namespace unless they set
+// one, and labelled as managed by the Webserver and written by
+// fieldManager.
+func runBuilders(instance *serversv1alpha1.Webserver, builders []ResourceBuilder, fieldManager string, render func() (*manifests, error)) (*manifests, []client.Object, error) {
+	chain := builders
+	hasDefault := false
+	for _, builder := range builders {
+		if isDefaultBuilder(builder) {
+			hasDefault = true
+			break
+		}
+	}
+	if !hasDefault {
+		chain = append([]ResourceBuilder{DefaultResourceBuilder{}}, builders...)
+	}
+
+	var desired *manifests
+	var objs []client.Object
+	builtin := map[client.Object]bool{}
+	for _, builder := range chain {
+		if !isDefaultBuilder(builder) {
+			var err error
+			if objs, err = builder.Build(instance, objs); err != nil {
+				return nil, nil, fmt.Errorf("resource builder %T: %w", builder, err)
+			}
+			continue
+		}
+		if desired != nil {
+			continue
+		}
+		m, err := render()
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, obj := range m.objects() {
+			builtin[obj] = true
+			objs = append(objs, obj)
+		}
+		desired = m
+	}
+
+	var extra []client.Object
+	for _, obj := range objs {
+		if builtin[obj] {
+			continue
+		}
+		if obj.GetNamespace() == "" {
+			obj.SetNamespace(targetNamespace(instance))
+		}
+		addOwnerLabels(instance, obj, fieldManager)
+		labels := obj.GetLabels()
+		labels[builderLabel] = "true"
+		obj.SetLabels(labels)
+		extra = append(extra, obj)
+	}
+	return desired, extra, nil
+}
+
+// addedByBuilder reports whether a ResourceBuilder added obj.
+func addedByBuilder(obj client.Object) bool {
+	return obj.GetLabels()[builderLabel] == "true"
+}
+
+// buildManifests renders the Webserver's objects through the builder
+// chain, collecting the objects the builders add in Extra.
+func (r *WebserverReconciler) buildManifests(instance *serversv1alpha1.Webserver) (*manifests, error) {
+	desired, objs, err := runBuilders(instance, r.Builders, r.fieldManager(), func() (*manifests, error) {
+		return renderManifests(instance, r.fieldManager())
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, obj := range objs {
+		extra, err := r.toUnstructured(obj)
+		if err != nil {
+			return nil, fmt.Errorf("resource builder object %s: %w", obj.GetName(), err)
+		}
+		desired.Extra = append(desired.Extra, extra)
+	}
+	return desired, nil
+}
+
+// toUnstructured converts obj, typed or unstructured, to an unstructured
+// object with its apiVersion and kind set.
+func (r *WebserverReconciler) toUnstructured(obj client.Object) (*unstructured.Unstructured, error) {
+	gvk, err := apiutil.GVKForObject(obj, r.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	var content map[string]interface{}
+	if u, ok := obj.(runtime.Unstructured); ok {
+		content = runtime.DeepCopyJSON(u.UnstructuredContent())
+	} else if content, err = runtime.DefaultUnstructuredConverter.ToUnstructured(obj); err != nil {
+		return nil, err
+	}
+	u := &unstructured.Unstructured{Object: content}
+	u.SetGroupVersionKind(gvk)
+	return u, nil
+}
+
+// reconcileExtraObject creates or updates an object a ResourceBuilder
+// added, replacing its top-level fields other than metadata and status
+// with the desired ones.
+func (r *WebserverReconciler) reconcileExtraObject(ctx context.Context, instance *serversv1alpha1.Webserver, desired *unstructured.Unstructured) error {
+	var obj *unstructured.Unstructured
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		obj = &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(desired.GroupVersionKind())
+		obj.SetName(desired.GetName())
+		obj.SetNamespace(desired.GetNamespace())
+		op, err = r.createOrUpdate(ctx, obj, func() error {
+			liveVersion = obj.GetResourceVersion()
+			for key, value := range desired.Object {
+				switch key {
+				case "apiVersion", "kind", "metadata", "status":
+				default:
+					obj.Object[key] = runtime.DeepCopyJSONValue(value)
+				}
+			}
+			labels := obj.GetLabels()
+			if labels == nil {
+				labels = map[string]string{}
+			}
+			for k, v := range desired.GetLabels() {
+				labels[k] = v
+			}
+			obj.SetLabels(labels)
+			return r.setOwner(instance, obj)
+		})
+		return err
+	})
+	recordAction(ctx, instance, desired.GetKind(), desired.GetName(), liveVersion, obj.GetResourceVersion(), err)
+	if err != nil {
+		return err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled object from resource builder", "kind", desired.GetKind(), "name", desired.GetName(), "operation", op)
+	return nil
+}
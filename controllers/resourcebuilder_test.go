@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// sidecarConfigBuilder adds a ConfigMap and annotates the Deployment.
+type sidecarConfigBuilder struct{}
+
+func (sidecarConfigBuilder) Build(instance *serversv1alpha1.Webserver, objs []client.Object) ([]client.Object, error) {
+	for _, obj := range objs {
+		if deployment, ok := obj.(*appsv1.Deployment); ok {
+			if deployment.Annotations == nil {
+				deployment.Annotations = map[string]string{}
+			}
+			deployment.Annotations["example.com/sidecar"] = "true"
+		}
+	}
+	return append(objs, &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: instance.Name + "-sidecar"},
+		Data:       map[string]string{"level": "debug"},
+	}), nil
+}
+
+var _ = Describe("Resource builders", func() {
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-current"},
+		}
+		r = newFakeReconciler(instance)
+		r.Builders = []ResourceBuilder{sidecarConfigBuilder{}}
+	})
+
+	It("applies the builders' changes and the objects they add", func() {
+		desired, err := r.buildManifests(instance)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(desired.Deployment.Annotations).To(HaveKeyWithValue("example.com/sidecar", "true"))
+		Expect(desired.Extra).To(HaveLen(1))
+		extra := desired.Extra[0]
+		Expect(extra.GetKind()).To(Equal("ConfigMap"))
+		Expect(extra.GetNamespace()).To(Equal("default"))
+		Expect(extra.GetLabels()).To(HaveKeyWithValue(ownerNameLabel, "web"))
+
+		Expect(r.reconcileExtraObject(ctx, instance, extra)).To(Succeed())
+		configMap := &corev1.ConfigMap{}
+		Expect(r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web-sidecar"}, configMap)).To(Succeed())
+		Expect(configMap.Data).To(Equal(map[string]string{"level": "debug"}))
+		Expect(configMap.Labels).To(HaveKeyWithValue(ownerNameLabel, "web"))
+		Expect(controllerRefs(configMap)).To(HaveLen(1))
+	})
+
+	It("keeps the objects builders add across reconciles and moves them with the Webserver", func() {
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)}
+		r.setDefaults()
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		// The fake client cannot list objects created unstructured into
+		// typed lists, as the API server can, so store it typed.
+		sidecar := client.ObjectKey{Namespace: "default", Name: "web-sidecar"}
+		configMap := &corev1.ConfigMap{}
+		Expect(r.Client.Get(ctx, sidecar, configMap)).To(Succeed())
+		Expect(r.Client.Delete(ctx, configMap)).To(Succeed())
+		configMap.ResourceVersion = ""
+		Expect(r.Client.Create(ctx, configMap)).To(Succeed())
+
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Client.Get(ctx, sidecar, &corev1.ConfigMap{})).To(Succeed())
+
+		Expect(r.Client.Get(ctx, req.NamespacedName, instance)).To(Succeed())
+		instance.Spec.TargetNamespace = "other"
+		Expect(r.Client.Update(ctx, instance)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		err = r.Client.Get(ctx, sidecar, &corev1.ConfigMap{})
+		Expect(errors.IsNotFound(err)).To(BeTrue())
+		Expect(r.Client.Get(ctx, client.ObjectKey{Namespace: "other", Name: "web-sidecar"}, &corev1.ConfigMap{})).To(Succeed())
+	})
+
+	It("renders the objects builders add", func() {
+		objs, err := RenderManifests(instance, sidecarConfigBuilder{})
+		Expect(err).NotTo(HaveOccurred())
+		last := objs[len(objs)-1]
+		Expect(last.GetName()).To(Equal("web-sidecar"))
+		Expect(last.GetLabels()).To(HaveKeyWithValue(builderLabel, "true"))
+		Expect(objs[0].GetAnnotations()).To(HaveKeyWithValue("example.com/sidecar", "true"))
+	})
+})
@@ -0,0 +1,201 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	routev1 "github.com/openshift/api/route/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// countingClient counts the updates sent through it.
+type countingClient struct {
+	client.Client
+	updates int
+}
+
+func (c *countingClient) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	c.updates++
+	return c.Client.Update(ctx, obj, opts...)
+}
+
+var _ = Describe("Route updates", func() {
+	var (
+		ctx      context.Context
+		instance *serversv1alpha1.Webserver
+		r        *WebserverReconciler
+		counter  *countingClient
+		desired  *manifests
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "uid-current"},
+		}
+		r = newFakeReconciler(instance)
+		counter = &countingClient{Client: r.Client}
+		r.Client = counter
+
+		var err error
+		desired, err = renderManifests(instance, DefaultFieldManager)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+
+		// Fill in what the API server and router add to a live Route.
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		weight := int32(100)
+		route.Spec.Host = "web-default.apps.example.com"
+		route.Spec.To.Weight = &weight
+		route.Spec.WildcardPolicy = routev1.WildcardPolicyNone
+		route.Annotations = map[string]string{"openshift.io/host.generated": "true"}
+		route.Status.Ingress = []routev1.RouteIngress{{
+			Host:       route.Spec.Host,
+			RouterName: "default",
+			Conditions: []routev1.RouteIngressCondition{{Type: routev1.RouteAdmitted, Status: corev1.ConditionTrue}},
+		}}
+		Expect(r.Client.Update(ctx, route)).To(Succeed())
+		counter.updates = 0
+	})
+
+	It("does not update a Route whose managed fields match", func() {
+		for i := 0; i < 2; i++ {
+			_, err := r.reconcileRoute(ctx, instance, desired.Route)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(counter.updates).To(BeZero())
+
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Spec.Host).To(Equal("web-default.apps.example.com"))
+		Expect(route.Status.Ingress).To(HaveLen(1))
+	})
+
+	It("updates only the managed fields that differ", func() {
+		desired.Route.Spec.To.Name = "web-other"
+		_, err := r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counter.updates).To(Equal(1))
+
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Spec.To.Name).To(Equal("web-other"))
+		Expect(*route.Spec.To.Weight).To(BeEquivalentTo(100))
+		Expect(route.Spec.Host).To(Equal("web-default.apps.example.com"))
+		Expect(route.Annotations).To(HaveKeyWithValue("openshift.io/host.generated", "true"))
+		Expect(route.Status.Ingress).To(HaveLen(1))
+	})
+
+	It("keeps TLS configured on the Route", func() {
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		route.Spec.TLS = &routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}
+		Expect(r.Client.Update(ctx, route)).To(Succeed())
+		counter.updates = 0
+
+		desired.Route.Spec.To.Name = "web-other"
+		_, err := r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(counter.updates).To(Equal(1))
+
+		route = &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Spec.TLS).To(Equal(&routev1.TLSConfig{Termination: routev1.TLSTerminationEdge}))
+	})
+
+	It("merges its labels and annotations into the Route's by default", func() {
+		desired.Route.Labels["team"] = "web"
+		desired.Route.Annotations = map[string]string{routeTimeoutAnnotation: "2m"}
+		_, err := r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Labels).To(HaveKeyWithValue("team", "web"))
+		Expect(route.Annotations).To(Equal(map[string]string{
+			"openshift.io/host.generated": "true",
+			routeTimeoutAnnotation:        "2m",
+		}))
+
+		desired.Route.Annotations = nil
+		_, err = r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+		route = &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Annotations).To(Equal(map[string]string{"openshift.io/host.generated": "true"}))
+	})
+
+	It("replaces the Route's labels and annotations with the Replace policy", func() {
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		route.Labels["gitops.example.com/app"] = "web"
+		Expect(r.Client.Update(ctx, route)).To(Succeed())
+
+		instance.Spec.RouteMetadata = serversv1alpha1.RouteMetadataReplace
+		desired.Route.Annotations = map[string]string{routeTimeoutAnnotation: "2m"}
+		_, err := r.reconcileRoute(ctx, instance, desired.Route)
+		Expect(err).NotTo(HaveOccurred())
+
+		route = &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		Expect(route.Labels).To(Equal(desired.Route.Labels))
+		Expect(route.Annotations).To(Equal(map[string]string{routeTimeoutAnnotation: "2m"}))
+	})
+
+	It("reports when the router admits the Route with another host", func() {
+		Expect(r.reconcileExposure(ctx, instance, desired, "default")).To(Succeed())
+		Expect(instance.Status.AdmittedHost).To(Equal("web-default.apps.example.com"))
+		Expect(meta.IsStatusConditionFalse(instance.Status.Conditions, serversv1alpha1.ConditionHostChanged)).To(BeTrue())
+
+		route := &routev1.Route{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired.Route), route)).To(Succeed())
+		route.Status.Ingress[0].Host = "web-default.apps.new.example.com"
+		Expect(r.Client.Update(ctx, route)).To(Succeed())
+
+		for i := 0; i < 2; i++ {
+			Expect(r.reconcileExposure(ctx, instance, desired, "default")).To(Succeed())
+			Expect(instance.Status.AdmittedHost).To(Equal("web-default.apps.new.example.com"))
+			Expect(meta.IsStatusConditionTrue(instance.Status.Conditions, serversv1alpha1.ConditionHostChanged)).To(BeTrue())
+		}
+
+		instance.Generation++
+		Expect(r.reconcileExposure(ctx, instance, desired, "default")).To(Succeed())
+		Expect(meta.IsStatusConditionFalse(instance.Status.Conditions, serversv1alpha1.ConditionHostChanged)).To(BeTrue())
+	})
+
+	It("keeps the hosts while the Route is held from being recreated", func() {
+		Expect(r.reconcileExposure(ctx, instance, desired, "default")).To(Succeed())
+		Expect(instance.Status.AdmittedHost).To(Equal("web-default.apps.example.com"))
+
+		desired.Route = nil
+		desired.RouteHeld = true
+		Expect(r.reconcileExposure(ctx, instance, desired, "default")).To(Succeed())
+		Expect(instance.Status.Host).To(Equal("web-default.apps.example.com"))
+		Expect(instance.Status.AdmittedHost).To(Equal("web-default.apps.example.com"))
+		Expect(meta.FindStatusCondition(instance.Status.Conditions, serversv1alpha1.ConditionHostChanged)).NotTo(BeNil())
+	})
+})
@@ -0,0 +1,60 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// ReconcileAll reconciles every Webserver in the cluster once, one after the
+// other, and returns the errors of those that failed. It is meant for batch
+// runs without a manager, such as smoke tests after a cluster restore, so the
+// reconcile cooldown and circuit breaker do not apply and requeues are
+// ignored.
+func (r *WebserverReconciler) ReconcileAll(ctx context.Context) error {
+	logger := log.FromContext(ctx)
+	r.setDefaults()
+
+	list := &serversv1alpha1.WebserverList{}
+	if err := r.Client.List(ctx, list); err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range list.Items {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		key := client.ObjectKeyFromObject(&list.Items[i])
+		rctx := log.IntoContext(ctx, logger.WithValues("webserver", key))
+		if _, err := r.reconcile(rctx, ctrl.Request{NamespacedName: key}); err != nil {
+			logger.Error(err, "Reconcile failed", "webserver", key)
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	logger.Info("Reconciled Webservers", "total", len(list.Items), "failed", len(errs))
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	appsv1 "k8s.io/api/apps/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// scheduleLookback bounds how far back the last firing of a scale rule is
+// searched for. Each window is only searched when the rule did not fire in
+// the previous one, which keeps frequent schedules cheap.
+var scheduleLookback = []time.Duration{time.Hour, 24 * time.Hour, 7 * 24 * time.Hour, 31 * 24 * time.Hour, 366 * 24 * time.Hour}
+
+// applyScaleSchedule sets the desired Deployment's replicas to those of the
+// Webserver's scale rule that fired most recently before now, and returns
+// how long until the next rule fires. Without a schedule, or when a
+// DaemonSet runs the pods, it returns zero.
+func applyScaleSchedule(instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment, now time.Time) (time.Duration, error) {
+	schedule := instance.Spec.ScaleSchedule
+	if schedule == nil || len(schedule.Rules) == 0 || instance.Spec.WorkloadType == serversv1alpha1.WorkloadDaemonSet {
+		return 0, nil
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		return 0, fmt.Errorf("loading scale schedule time zone: %w", err)
+	}
+	now = now.In(location)
+
+	var last, next time.Time
+	for _, rule := range schedule.Rules {
+		s, err := cron.ParseStandard(rule.Schedule)
+		if err != nil {
+			return 0, fmt.Errorf("parsing scale schedule %q: %w", rule.Schedule, err)
+		}
+		if fires := s.Next(now); next.IsZero() || fires.Before(next) {
+			next = fires
+		}
+		if fired := lastFiring(s, now); !fired.IsZero() && fired.After(last) {
+			last = fired
+			replicas := rule.Replicas
+			deployment.Spec.Replicas = &replicas
+		}
+	}
+	if next.IsZero() {
+		return 0, nil
+	}
+	return next.Sub(now), nil
+}
+
+// lastFiring returns the last time at or before now that s fired, or the
+// zero time when it did not fire within the lookback.
+func lastFiring(s cron.Schedule, now time.Time) time.Time {
+	for _, window := range scheduleLookback {
+		var fired time.Time
+		for t := s.Next(now.Add(-window)); !t.IsZero() && !t.After(now); t = s.Next(t) {
+			fired = t
+		}
+		if !fired.IsZero() {
+			return fired
+		}
+	}
+	return time.Time{}
+}
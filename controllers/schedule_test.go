@@ -0,0 +1,59 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+	// Like the manager, don't depend on the host's zoneinfo.
+	_ "time/tzdata"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Scale schedules", func() {
+	It("evaluates the rules in the schedule's time zone", func() {
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: serversv1alpha1.WebserverSpec{
+				ScaleSchedule: &serversv1alpha1.ScaleSchedule{
+					TimeZone: "Europe/Paris",
+					Rules: []serversv1alpha1.ScaleRule{
+						{Schedule: "0 20 * * *", Replicas: 0},
+						{Schedule: "0 8 * * *", Replicas: 3},
+					},
+				},
+			},
+		}
+		Expect(instance.ValidateSpec()).To(BeEmpty())
+
+		// 19:30 UTC is 20:30 in Paris in winter, after the evening rule
+		// fired there but before it would fire in UTC.
+		now := time.Date(2026, time.January, 15, 19, 30, 0, 0, time.UTC)
+		deployment := &appsv1.Deployment{}
+		next, err := applyScaleSchedule(instance, deployment, now)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(deployment.Spec.Replicas).NotTo(BeNil())
+		Expect(*deployment.Spec.Replicas).To(BeZero())
+		// The morning rule fires at 08:00 in Paris, 07:00 UTC.
+		Expect(next).To(Equal(11*time.Hour + 30*time.Minute))
+	})
+})
@@ -0,0 +1,323 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/workqueue"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// secretChecksumAnnotation records a checksum of the data of every
+	// Secret the pod template references, so rotating one rolls the pods.
+	secretChecksumAnnotation = "servers.redhat.com/secret-checksum"
+
+	// secretIndex indexes Webservers by the namespace/name of the Secrets
+	// their pods reference.
+	secretIndex = ".spec.secrets"
+)
+
+// missingSecretChecksum stands in for the checksum of a Secret that does
+// not exist.
+const missingSecretChecksum = "missing"
+
+// secretDigests remembers what the reconciler derives from each Secret's
+// data at the resourceVersion it was derived for, so the data is only read
+// again once the Secret changes.
+type secretDigests struct {
+	mu      sync.Mutex
+	entries map[types.NamespacedName]*secretDigest
+}
+
+// secretDigest is what the reconciler needs from a Secret's data: its
+// checksum, and the expiry of the TLS certificate it holds, or why there is
+// none.
+type secretDigest struct {
+	resourceVersion string
+	checksum        string
+	notAfter        time.Time
+	certificateErr  error
+}
+
+func newSecretDigests() *secretDigests {
+	return &secretDigests{entries: map[types.NamespacedName]*secretDigest{}}
+}
+
+// get returns the digest recorded for the Secret at resourceVersion.
+func (c *secretDigests) get(key types.NamespacedName, resourceVersion string) (*secretDigest, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	digest, ok := c.entries[key]
+	if !ok || digest.resourceVersion != resourceVersion {
+		return nil, false
+	}
+	return digest, true
+}
+
+// set records the digest of the Secret.
+func (c *secretDigests) set(key types.NamespacedName, digest *secretDigest) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = digest
+}
+
+// forget drops the digest of a Secret that no longer exists.
+func (c *secretDigests) forget(key types.NamespacedName) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// keys returns the Secrets a digest is recorded for.
+func (c *secretDigests) keys() []types.NamespacedName {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]types.NamespacedName, 0, len(c.entries))
+	for key := range c.entries {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// forgetUnreferencedSecrets drops the digests of Secrets no Webserver
+// references any more, once a Webserver is gone or stopped referencing them.
+func (r *WebserverReconciler) forgetUnreferencedSecrets(ctx context.Context) error {
+	for _, key := range r.secretDigests.keys() {
+		list := &serversv1alpha1.WebserverList{}
+		if err := r.Client.List(ctx, list, client.MatchingFields{secretIndex: key.String()}); err != nil {
+			return err
+		}
+		if len(list.Items) == 0 {
+			r.secretDigests.forget(key)
+		}
+	}
+	return nil
+}
+
+// secretEventHandler enqueues the Webservers that reference a Secret, and
+// forgets the digest of a Secret when it is deleted.
+type secretEventHandler struct {
+	handler.EventHandler
+	digests *secretDigests
+}
+
+func (h secretEventHandler) Delete(e event.DeleteEvent, q workqueue.RateLimitingInterface) {
+	h.digests.forget(client.ObjectKeyFromObject(e.Object))
+	h.EventHandler.Delete(e, q)
+}
+
+// applySecretChecksum stamps a checksum of the Secrets the desired
+// Deployment's pods reference on its pod template.
+func (r *WebserverReconciler) applySecretChecksum(ctx context.Context, deployment *appsv1.Deployment) error {
+	names := referencedSecrets(&deployment.Spec.Template.Spec)
+	if len(names) == 0 {
+		return nil
+	}
+
+	h := sha256.New()
+	for _, name := range names {
+		checksum, err := r.secretDataChecksum(ctx, types.NamespacedName{Name: name, Namespace: deployment.Namespace})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", name, checksum)
+	}
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.Annotations[secretChecksumAnnotation] = fmt.Sprintf("%x", h.Sum(nil))
+	return nil
+}
+
+// secretDataChecksum returns the checksum of the Secret's data, or
+// missingSecretChecksum.
+func (r *WebserverReconciler) secretDataChecksum(ctx context.Context, key types.NamespacedName) (string, error) {
+	digest, err := r.readSecretDigest(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if digest == nil {
+		return missingSecretChecksum, nil
+	}
+	return digest.checksum, nil
+}
+
+// readSecretDigest returns the digest of the Secret, or nil when it does not
+// exist. The cache only holds Secret metadata, so the data is read from the
+// API server, but only when the resourceVersion in the cache has moved since
+// the digest was last derived.
+func (r *WebserverReconciler) readSecretDigest(ctx context.Context, key types.NamespacedName) (*secretDigest, error) {
+	if r.secretDigests != nil {
+		metadata := &metav1.PartialObjectMetadata{}
+		metadata.SetGroupVersionKind(corev1.SchemeGroupVersion.WithKind("Secret"))
+		err := r.Client.Get(ctx, key, metadata)
+		switch {
+		case errors.IsNotFound(err):
+			r.secretDigests.forget(key)
+			return nil, nil
+		case err != nil:
+			return nil, err
+		}
+		if digest, ok := r.secretDigests.get(key, metadata.ResourceVersion); ok {
+			return digest, nil
+		}
+	}
+
+	reader := r.apiReader
+	if reader == nil {
+		reader = r.Client
+	}
+	secret := &corev1.Secret{}
+	err := reader.Get(ctx, key, secret)
+	switch {
+	case errors.IsNotFound(err):
+		r.secretDigests.forget(key)
+		return nil, nil
+	case err != nil:
+		return nil, err
+	}
+	digest := &secretDigest{resourceVersion: secret.ResourceVersion, checksum: secretChecksum(secret)}
+	digest.notAfter, digest.certificateErr = certificateNotAfter(secret.Data[corev1.TLSCertKey])
+	r.secretDigests.set(key, digest)
+	return digest, nil
+}
+
+// secretChecksum returns a stable hash of the Secret's data.
+func secretChecksum(secret *corev1.Secret) string {
+	keys := make([]string, 0, len(secret.Data))
+	for k := range secret.Data {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00", k)
+		h.Write(secret.Data[k])
+		h.Write([]byte{0})
+	}
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// referencedSecrets returns the sorted names of the Secrets a pod spec
+// mounts, reads environment variables from or pulls images with.
+func referencedSecrets(spec *corev1.PodSpec) []string {
+	seen := map[string]bool{}
+	add := func(name string) {
+		if name != "" {
+			seen[name] = true
+		}
+	}
+	for _, ref := range spec.ImagePullSecrets {
+		add(ref.Name)
+	}
+	for _, volume := range spec.Volumes {
+		if volume.Secret != nil {
+			add(volume.Secret.SecretName)
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.Secret != nil {
+					add(source.Secret.Name)
+				}
+			}
+		}
+	}
+	containers := append(append([]corev1.Container{}, spec.InitContainers...), spec.Containers...)
+	for _, container := range containers {
+		for _, env := range container.Env {
+			if env.ValueFrom != nil && env.ValueFrom.SecretKeyRef != nil {
+				add(env.ValueFrom.SecretKeyRef.Name)
+			}
+		}
+		for _, source := range container.EnvFrom {
+			if source.SecretRef != nil {
+				add(source.SecretRef.Name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// secretIndexValue returns the secretIndex keys for a Webserver.
+func secretIndexValue(obj client.Object) []string {
+	instance := obj.(*serversv1alpha1.Webserver)
+	namespace := targetNamespace(instance)
+	spec := &deploymentForWebserver(instance, namespace).Spec.Template.Spec
+	if err := serversv1alpha1.ApplyPodSpecPatch(spec, instance.Spec.PodSpecPatch); err != nil {
+		return nil
+	}
+
+	var keys []string
+	for _, name := range referencedSecrets(spec) {
+		keys = append(keys, namespace+"/"+name)
+	}
+	return keys
+}
+
+// webserversForSecret maps a Secret to reconcile requests for the Webservers
+// whose pods reference it.
+func (r *WebserverReconciler) webserversForSecret(obj client.Object) []ctrl.Request {
+	list := &serversv1alpha1.WebserverList{}
+	err := r.Client.List(context.Background(), list,
+		client.MatchingFields{secretIndex: obj.GetNamespace() + "/" + obj.GetName()})
+	if err != nil {
+		ctrl.Log.WithName("webserver").Error(err, "Listing Webservers for Secret", "secret", obj.GetName())
+		return nil
+	}
+
+	requests := make([]ctrl.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// countingReader counts the reads that bypass the cache.
+type countingReader struct {
+	client.Reader
+	gets int
+}
+
+func (c *countingReader) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	c.gets++
+	return c.Reader.Get(ctx, key, obj)
+}
+
+var _ = Describe("Secret checksums", func() {
+	It("only reads a Secret's data when its resourceVersion moves", func() {
+		ctx := context.Background()
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "creds", Namespace: "default"},
+			Data:       map[string][]byte{"password": []byte("one")},
+		}
+		r := newFakeReconciler(secret)
+		reader := &countingReader{Reader: r.Client}
+		r.apiReader = reader
+		r.secretDigests = newSecretDigests()
+
+		checksum := func() string {
+			deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+			deployment.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "creds"}}
+			Expect(r.applySecretChecksum(ctx, deployment)).To(Succeed())
+			return deployment.Spec.Template.Annotations[secretChecksumAnnotation]
+		}
+
+		first := checksum()
+		Expect(checksum()).To(Equal(first))
+		Expect(reader.gets).To(Equal(1))
+
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+		secret.Data["password"] = []byte("two")
+		Expect(r.Client.Update(ctx, secret)).To(Succeed())
+		Expect(checksum()).NotTo(Equal(first))
+		Expect(reader.gets).To(Equal(2))
+	})
+
+	It("shares the read of a TLS Secret between the checksum and the certificate check", func() {
+		ctx := context.Background()
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "default"},
+			Data:       map[string][]byte{corev1.TLSCertKey: []byte("not a certificate")},
+		}
+		instance := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		instance.Spec.TLS = &serversv1alpha1.TLSCertificate{SecretName: "tls"}
+		r := newFakeReconciler(secret, instance)
+		reader := &countingReader{Reader: r.Client}
+		r.apiReader = reader
+		r.secretDigests = newSecretDigests()
+
+		for i := 0; i < 2; i++ {
+			_, err := r.checkCertificate(ctx, instance, "default", time.Now())
+			Expect(err).NotTo(HaveOccurred())
+			condition := meta.FindStatusCondition(instance.Status.Conditions, serversv1alpha1.ConditionCertificateExpiring)
+			Expect(condition.Reason).To(Equal("InvalidCertificate"))
+		}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"}}
+		deployment.Spec.Template.Spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "tls"}}
+		Expect(r.applySecretChecksum(ctx, deployment)).To(Succeed())
+		Expect(reader.gets).To(Equal(1))
+	})
+
+	It("forgets the digests of deleted Secrets and of Secrets no Webserver references", func() {
+		ctx := context.Background()
+		r := newFakeReconciler()
+		r.secretDigests = newSecretDigests()
+		deleted := types.NamespacedName{Namespace: "default", Name: "deleted"}
+		orphaned := types.NamespacedName{Namespace: "default", Name: "orphaned"}
+		r.secretDigests.set(deleted, &secretDigest{resourceVersion: "1"})
+		r.secretDigests.set(orphaned, &secretDigest{resourceVersion: "1"})
+
+		h := secretEventHandler{EventHandler: &handler.Funcs{}, digests: r.secretDigests}
+		h.Delete(event.DeleteEvent{Object: &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "deleted", Namespace: "default"}}}, nil)
+		Expect(r.secretDigests.keys()).To(ConsistOf(orphaned))
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "gone"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.secretDigests.keys()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,102 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// selectorRecreateRequeue is how often to check whether an orphaning
+// Deployment deletion has finished.
+const selectorRecreateRequeue = 2 * time.Second
+
+// recreateForSelector deletes the Webserver's Deployment, orphaning its
+// ReplicaSets and pods, when RecreateOnSelectorChange is set and the live
+// selector differs from the desired one. It only does so once the live
+// pods carry the desired selector labels, so that the recreated Deployment
+// adopts them and the Services keep selecting ready pods throughout. It
+// reports whether the Deployment is being replaced, in which case it must
+// not be applied yet.
+func (r *WebserverReconciler) recreateForSelector(ctx context.Context, instance *serversv1alpha1.Webserver, desired *appsv1.Deployment) (bool, error) {
+	workloadType := instance.Spec.WorkloadType
+	if !instance.Spec.RecreateOnSelectorChange || r.creating || (workloadType != "" && workloadType != serversv1alpha1.WorkloadDeployment) {
+		return false, nil
+	}
+	live := &appsv1.Deployment{}
+	err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), live)
+	switch {
+	case errors.IsNotFound(err):
+		return false, nil
+	case err != nil:
+		return false, err
+	}
+	if !live.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+	if equality.Semantic.DeepEqual(live.Spec.Selector, desired.Spec.Selector) || !metav1.IsControlledBy(live, instance) {
+		return false, nil
+	}
+	if !selectorMatchesPods(desired, live) {
+		return false, nil
+	}
+
+	from, to := metav1.FormatLabelSelector(live.Spec.Selector), metav1.FormatLabelSelector(desired.Spec.Selector)
+	// In observe mode the delete would be a dry run, leaving the Deployment
+	// in place and the reconcile waiting for it forever. Report the
+	// recreate as drift and apply the rest as usual instead.
+	if observer, ok := r.Client.(*observingClient); ok {
+		observer.record(live, "recreated", "selector: "+from+" -> "+to)
+		return false, nil
+	}
+
+	log.FromContext(ctx).Info("Recreating Deployment with new selector", "deployment", live.Name, "from", from, "to", to)
+	err = r.Client.Delete(ctx, live,
+		client.PropagationPolicy(metav1.DeletePropagationOrphan),
+		client.Preconditions{UID: &live.UID, ResourceVersion: &live.ResourceVersion})
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	return true, nil
+}
+
+// selectorMatchesPods reports whether every pod of the live Deployment,
+// once its rollout has finished, matches the desired Deployment's
+// selector.
+func selectorMatchesPods(desired, live *appsv1.Deployment) bool {
+	selector, err := metav1.LabelSelectorAsSelector(desired.Spec.Selector)
+	if err != nil || !selector.Matches(labels.Set(live.Spec.Template.Labels)) {
+		return false
+	}
+	replicas := int32(1)
+	if live.Spec.Replicas != nil {
+		replicas = *live.Spec.Replicas
+	}
+	return live.Status.ObservedGeneration >= live.Generation &&
+		live.Status.UpdatedReplicas == replicas &&
+		live.Status.Replicas == replicas
+}
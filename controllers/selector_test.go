@@ -0,0 +1,81 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Selector changes", func() {
+	It("reports a needed recreate as drift in observe mode", func() {
+		ctx := context.Background()
+		count := int32(1)
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				Namespace:   "default",
+				UID:         "web-uid",
+				Annotations: map[string]string{reconcileModeAnnotation: reconcileModeObserve},
+			},
+			Spec: serversv1alpha1.WebserverSpec{
+				Count:                    &count,
+				Selector:                 map[string]string{"name": "shop"},
+				PodLabels:                map[string]string{"name": "shop"},
+				RecreateOnSelectorChange: true,
+			},
+		}
+		instance.Status.TargetNamespace = "default"
+		// The live pods already carry the new selector labels.
+		live := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 1},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &count,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			Status: appsv1.DeploymentStatus{ObservedGeneration: 1, UpdatedReplicas: 1, Replicas: 1},
+		}
+		live.Spec.Template.Labels = map[string]string{"app": "web", "name": "shop"}
+		r := newFakeReconciler(instance)
+		Expect(r.setOwner(instance, live)).To(Succeed())
+		Expect(r.Client.Create(ctx, live)).To(Succeed())
+		r.setDefaults()
+
+		result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).NotTo(Equal(selectorRecreateRequeue))
+
+		got := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), got)).To(Succeed())
+		drifted := meta.FindStatusCondition(got.Status.Conditions, serversv1alpha1.ConditionDrifted)
+		Expect(drifted).NotTo(BeNil())
+		Expect(drifted.Message).To(ContainSubstring("Deployment/web would be recreated"))
+
+		deployment := &appsv1.Deployment{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(live), deployment)).To(Succeed())
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(map[string]string{"app": "web"}))
+	})
+})
@@ -0,0 +1,189 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+const (
+	// restartedAtAnnotation is the pod template annotation used by
+	// `kubectl rollout restart` to force a new rollout.
+	restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+	// revisionAnnotation is set by the Deployment controller on a Deployment
+	// and its ReplicaSets to track rollout revisions.
+	revisionAnnotation = "deployment.kubernetes.io/revision"
+
+	// progressDeadlineExceededReason is the Progressing condition reason the
+	// Deployment controller sets once a rollout has timed out.
+	progressDeadlineExceededReason = "ProgressDeadlineExceeded"
+)
+
+// recordLastKnownGood stores the pod-template-hash of the Deployment's
+// current ReplicaSet in status once its rollout has completed.
+func (r *WebserverReconciler) recordLastKnownGood(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) error {
+	if !rolloutComplete(deployment) {
+		return nil
+	}
+
+	rs, err := r.replicaSetForRevision(ctx, deployment, deployment.Annotations[revisionAnnotation])
+	if err != nil || rs == nil {
+		return err
+	}
+	hash := rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey]
+	if hash != instance.Status.LastKnownGoodHash {
+		log.FromContext(ctx).V(1).Info("Recording last known good ReplicaSet", "replicaSet", rs.Name, "hash", hash)
+		instance.Status.LastKnownGoodHash = hash
+	}
+	// A completed rollback does not count: only the Webserver's own pod
+	// template succeeding resets the attempts.
+	if instance.Status.SelfHealedGeneration != instance.Generation {
+		instance.Status.RollbackAttempts = 0
+	}
+	return nil
+}
+
+// selfHeal applies the Webserver's SelfHeal policy to a Deployment whose
+// rollout has exceeded its progress deadline. At most one action is taken per
+// Webserver generation.
+func (r *WebserverReconciler) selfHeal(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) error {
+	if !r.EnableSelfHeal || instance.Spec.SelfHeal == "" {
+		return nil
+	}
+	if instance.Status.SelfHealedGeneration == instance.Generation || !rolloutDegraded(deployment) {
+		return nil
+	}
+
+	logger := log.FromContext(ctx)
+
+	var rollbackTo *appsv1.ReplicaSet
+	switch instance.Spec.SelfHeal {
+	case serversv1alpha1.SelfHealRestart:
+		if deployment.Spec.Template.Annotations == nil {
+			deployment.Spec.Template.Annotations = map[string]string{}
+		}
+		deployment.Spec.Template.Annotations[restartedAtAnnotation] = time.Now().Format(time.RFC3339)
+	case serversv1alpha1.SelfHealRollback:
+		if limit := r.MaxRollbackAttempts; limit > 0 && instance.Status.RollbackAttempts >= limit {
+			logger.Info("Rollout is degraded but the rollback limit is reached", "attempts", instance.Status.RollbackAttempts)
+			r.event(ctx, instance, corev1.EventTypeWarning, "RollbackLimitReached",
+				"Rollout exceeded its progress deadline; not rolling back, the limit of %d rollbacks is reached", r.MaxRollbackAttempts)
+			return nil
+		}
+		if instance.Status.LastKnownGoodHash == "" {
+			logger.Info("Rollout is degraded but no known good revision is recorded")
+			return nil
+		}
+		rs, err := r.replicaSetForHash(ctx, deployment, instance.Status.LastKnownGoodHash)
+		if err != nil {
+			return err
+		}
+		if rs == nil {
+			logger.Info("Known good ReplicaSet no longer exists", "hash", instance.Status.LastKnownGoodHash)
+			return nil
+		}
+		template := rs.Spec.Template.DeepCopy()
+		delete(template.Labels, appsv1.DefaultDeploymentUniqueLabelKey)
+		deployment.Spec.Template = *template
+		rollbackTo = rs
+	}
+
+	logger.Info("Self-healing degraded rollout", "policy", instance.Spec.SelfHeal)
+	if err := r.Client.Update(ctx, deployment); err != nil {
+		return err
+	}
+	instance.Status.SelfHealedGeneration = instance.Generation
+	if rollbackTo == nil {
+		r.event(ctx, instance, corev1.EventTypeWarning, "RolloutRestarted",
+			"Restarted the Deployment's rollout after it exceeded its progress deadline")
+		return nil
+	}
+	now := metav1.Now()
+	instance.Status.RollbackAttempts++
+	instance.Status.LastRollbackTime = &now
+	r.event(ctx, instance, corev1.EventTypeWarning, "RolledBack",
+		"Rolled the Deployment back to ReplicaSet %s after its rollout exceeded its progress deadline (attempt %d)",
+		rollbackTo.Name, instance.Status.RollbackAttempts)
+	return nil
+}
+
+// replicaSetForRevision returns the ReplicaSet owned by the Deployment that
+// carries the given revision, or nil if there is none.
+func (r *WebserverReconciler) replicaSetForRevision(ctx context.Context, deployment *appsv1.Deployment, revision string) (*appsv1.ReplicaSet, error) {
+	return r.findReplicaSet(ctx, deployment, func(rs *appsv1.ReplicaSet) bool {
+		return revision != "" && rs.Annotations[revisionAnnotation] == revision
+	})
+}
+
+// replicaSetForHash returns the ReplicaSet owned by the Deployment with the
+// given pod-template-hash, or nil if there is none.
+func (r *WebserverReconciler) replicaSetForHash(ctx context.Context, deployment *appsv1.Deployment, hash string) (*appsv1.ReplicaSet, error) {
+	return r.findReplicaSet(ctx, deployment, func(rs *appsv1.ReplicaSet) bool {
+		return rs.Labels[appsv1.DefaultDeploymentUniqueLabelKey] == hash
+	})
+}
+
+func (r *WebserverReconciler) findReplicaSet(ctx context.Context, deployment *appsv1.Deployment, match func(*appsv1.ReplicaSet) bool) (*appsv1.ReplicaSet, error) {
+	list := &appsv1.ReplicaSetList{}
+	err := r.Client.List(ctx, list,
+		client.InNamespace(deployment.Namespace),
+		client.MatchingLabels(deployment.Spec.Selector.MatchLabels))
+	if err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if metav1.IsControlledBy(rs, deployment) && match(rs) {
+			return rs, nil
+		}
+	}
+	return nil, nil
+}
+
+// rolloutComplete reports whether every replica of the Deployment runs the
+// latest pod template and is available.
+func rolloutComplete(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas &&
+		deployment.Status.AvailableReplicas == replicas
+}
+
+// rolloutDegraded reports whether the Deployment controller has given up on
+// the current rollout because it exceeded its progress deadline.
+func rolloutDegraded(deployment *appsv1.Deployment) bool {
+	for _, c := range deployment.Status.Conditions {
+		if c.Type == appsv1.DeploymentProgressing {
+			return c.Status == corev1.ConditionFalse && c.Reason == progressDeadlineExceededReason
+		}
+	}
+	return false
+}
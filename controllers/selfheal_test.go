@@ -0,0 +1,122 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Rollback self-healing", func() {
+	var (
+		ctx        context.Context
+		instance   *serversv1alpha1.Webserver
+		deployment *appsv1.Deployment
+		r          *WebserverReconciler
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		one := int32(1)
+		controller := true
+		instance = &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", Generation: 1},
+			Spec:       serversv1alpha1.WebserverSpec{SelfHeal: serversv1alpha1.SelfHealRollback},
+		}
+		instance.Status.LastKnownGoodHash = "good"
+		deployment = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default", UID: "deployment-uid"},
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &one,
+				Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			},
+			Status: appsv1.DeploymentStatus{Conditions: []appsv1.DeploymentCondition{{
+				Type:   appsv1.DeploymentProgressing,
+				Status: corev1.ConditionFalse,
+				Reason: progressDeadlineExceededReason,
+			}}},
+		}
+		good := &appsv1.ReplicaSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "web-good",
+				Namespace: "default",
+				Labels:    map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: "good"},
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: "apps/v1",
+					Kind:       "Deployment",
+					Name:       "web",
+					UID:        deployment.UID,
+					Controller: &controller,
+				}},
+			},
+		}
+		good.Spec.Template.Labels = map[string]string{"app": "web", appsv1.DefaultDeploymentUniqueLabelKey: "good"}
+		r = newFakeReconciler(deployment, good)
+		r.EnableSelfHeal = true
+		r.MaxRollbackAttempts = 2
+		live := &appsv1.Deployment{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(deployment), live)).To(Succeed())
+		deployment = live
+	})
+
+	It("counts one rollback per generation and stops at the limit", func() {
+		Expect(r.selfHeal(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(1))
+		Expect(deployment.Spec.Template.Labels).NotTo(HaveKey(appsv1.DefaultDeploymentUniqueLabelKey))
+
+		// The same generation is only healed once.
+		Expect(r.selfHeal(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(1))
+
+		instance.Generation++
+		Expect(r.selfHeal(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(2))
+
+		instance.Generation++
+		Expect(r.selfHeal(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(2))
+		Expect(instance.Status.SelfHealedGeneration).To(Equal(instance.Generation - 1))
+	})
+
+	It("resets the attempts once the Webserver's own template rolls out", func() {
+		Expect(r.selfHeal(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(1))
+
+		deployment.Annotations = map[string]string{revisionAnnotation: "3"}
+		deployment.Status = appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}
+		good := &appsv1.ReplicaSet{}
+		Expect(r.Client.Get(ctx, client.ObjectKey{Namespace: "default", Name: "web-good"}, good)).To(Succeed())
+		good.Annotations = map[string]string{revisionAnnotation: "3"}
+		Expect(r.Client.Update(ctx, good)).To(Succeed())
+
+		// A completed rollback does not reset them.
+		Expect(r.recordLastKnownGood(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeEquivalentTo(1))
+
+		instance.Generation++
+		Expect(r.recordLastKnownGood(ctx, instance, deployment)).To(Succeed())
+		Expect(instance.Status.RollbackAttempts).To(BeZero())
+	})
+})
@@ -0,0 +1,62 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Services", func() {
+	It("keeps the node ports allocated to a Service", func() {
+		ctx := context.Background()
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		}
+		r := newFakeReconciler(instance)
+		desired := serviceForWebserver(instance, "default", serversv1alpha1.ServiceSpec{
+			Name:     "web",
+			Type:     corev1.ServiceTypeNodePort,
+			Protocol: corev1.ProtocolTCP,
+			Port:     8080,
+		})
+		_, err := r.reconcileService(ctx, instance, desired)
+		Expect(err).NotTo(HaveOccurred())
+		// The fake client does not allocate node ports or stamp the
+		// creation time as the API server would.
+		live := &corev1.Service{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired), live)).To(Succeed())
+		live.CreationTimestamp = metav1.Now()
+		live.Spec.Ports[0].NodePort = 30080
+		Expect(r.Client.Update(ctx, live)).To(Succeed())
+
+		desired.Spec.Ports[0].Port = 8081
+		_, err = r.reconcileService(ctx, instance, desired)
+		Expect(err).NotTo(HaveOccurred())
+		live = &corev1.Service{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(desired), live)).To(Succeed())
+		Expect(live.Spec.Ports[0].Port).To(Equal(int32(8081)))
+		Expect(live.Spec.Ports[0].NodePort).To(Equal(int32(30080)))
+	})
+})
@@ -0,0 +1,118 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// sidecarInjectionLabel on a namespace names the entry of the sidecar
+// templates ConfigMap whose containers are added to every Webserver pod in
+// that namespace.
+const sidecarInjectionLabel = "servers.redhat.com/sidecar-injection"
+
+// injectSidecars adds the sidecars the pods' namespace asks for through the
+// sidecarInjectionLabel to the desired Deployment's pod template, after the
+// Webserver's own Sidecars. A Webserver sidecar with the same name as an
+// injected one takes its place.
+func (r *WebserverReconciler) injectSidecars(ctx context.Context, deployment *appsv1.Deployment) error {
+	if r.SidecarTemplates.Name == "" {
+		return nil
+	}
+	namespace := &corev1.Namespace{}
+	if err := r.Client.Get(ctx, types.NamespacedName{Name: deployment.Namespace}, namespace); err != nil {
+		return err
+	}
+	template := namespace.Labels[sidecarInjectionLabel]
+	if template == "" {
+		return nil
+	}
+
+	configMap := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, r.SidecarTemplates, configMap)
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("sidecar templates ConfigMap %s does not exist", r.SidecarTemplates)
+	} else if err != nil {
+		return err
+	}
+	data, ok := configMap.Data[template]
+	if !ok {
+		return fmt.Errorf("sidecar templates ConfigMap %s has no template %q, requested by namespace %s", r.SidecarTemplates, template, namespace.Name)
+	}
+	var sidecars []corev1.Container
+	if err := yaml.UnmarshalStrict([]byte(data), &sidecars); err != nil {
+		return fmt.Errorf("sidecar template %q in ConfigMap %s: %w", template, r.SidecarTemplates, err)
+	}
+
+	spec := &deployment.Spec.Template.Spec
+	existing := map[string]bool{}
+	for _, container := range spec.Containers {
+		existing[container.Name] = true
+	}
+	for _, sidecar := range sidecars {
+		if !existing[sidecar.Name] {
+			spec.Containers = append(spec.Containers, sidecar)
+		}
+	}
+	return nil
+}
+
+// webserversForSidecarTemplates maps the sidecar templates ConfigMap to
+// reconcile requests for every Webserver, so template changes roll the
+// pods they are injected into.
+func (r *WebserverReconciler) webserversForSidecarTemplates(obj client.Object) []ctrl.Request {
+	if client.ObjectKeyFromObject(obj) != r.SidecarTemplates {
+		return nil
+	}
+	return r.webserversTargeting("")
+}
+
+// webserversForNamespace maps a namespace to reconcile requests for the
+// Webservers whose pods run in it, so changing its sidecarInjectionLabel
+// takes effect.
+func (r *WebserverReconciler) webserversForNamespace(obj client.Object) []ctrl.Request {
+	return r.webserversTargeting(obj.GetName())
+}
+
+// webserversTargeting returns reconcile requests for the Webservers whose
+// pods run in namespace, or for all Webservers when namespace is empty.
+func (r *WebserverReconciler) webserversTargeting(namespace string) []ctrl.Request {
+	list := &serversv1alpha1.WebserverList{}
+	if err := r.Client.List(context.Background(), list); err != nil {
+		ctrl.Log.WithName("webserver").Error(err, "Listing Webservers for sidecar injection")
+		return nil
+	}
+
+	var requests []ctrl.Request
+	for i := range list.Items {
+		if namespace == "" || targetNamespace(&list.Items[i]) == namespace {
+			requests = append(requests, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return requests
+}
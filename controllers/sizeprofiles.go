@@ -0,0 +1,116 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// SizeProfiles maps each SizeProfile to the webserver container's resources.
+// LoadSizeProfiles overrides the defaults from a ConfigMap.
+var SizeProfiles = map[serversv1alpha1.SizeProfile]corev1.ResourceRequirements{
+	serversv1alpha1.SizeProfileSmall: {
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("50m"),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("128Mi"),
+		},
+	},
+	serversv1alpha1.SizeProfileMedium: {
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("250m"),
+			corev1.ResourceMemory: resource.MustParse("256Mi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("512Mi"),
+		},
+	},
+	serversv1alpha1.SizeProfileLarge: {
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse("1"),
+			corev1.ResourceMemory: resource.MustParse("1Gi"),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceMemory: resource.MustParse("2Gi"),
+		},
+	},
+}
+
+// LoadSizeProfiles replaces the SizeProfiles given in the ConfigMap named by
+// key. Each data key is a profile name and its value the profile's
+// resources, in the YAML form of a container's resources field. Profiles the
+// ConfigMap leaves out keep their defaults.
+func LoadSizeProfiles(ctx context.Context, reader client.Reader, key types.NamespacedName) error {
+	configMap := &corev1.ConfigMap{}
+	if err := reader.Get(ctx, key, configMap); err != nil {
+		return fmt.Errorf("reading size profiles: %w", err)
+	}
+	for name, data := range configMap.Data {
+		profile := serversv1alpha1.SizeProfile(name)
+		if _, ok := SizeProfiles[profile]; !ok {
+			return fmt.Errorf("size profiles ConfigMap %s: unknown profile %q", key, name)
+		}
+		resources := corev1.ResourceRequirements{}
+		if err := yaml.UnmarshalStrict([]byte(data), &resources); err != nil {
+			return fmt.Errorf("size profiles ConfigMap %s: profile %q: %w", key, name, err)
+		}
+		SizeProfiles[profile] = resources
+	}
+	return nil
+}
+
+// resourcesForWebserver returns the webserver container's resources: those
+// of its SizeProfile, with any quantity set in Resources taking precedence.
+func resourcesForWebserver(instance *serversv1alpha1.Webserver) corev1.ResourceRequirements {
+	profile := SizeProfiles[instance.Spec.SizeProfile]
+	resources := corev1.ResourceRequirements{
+		Requests: mergeResources(profile.Requests, nil),
+		Limits:   mergeResources(profile.Limits, nil),
+	}
+	if explicit := instance.Spec.Resources; explicit != nil {
+		resources.Requests = mergeResources(resources.Requests, explicit.Requests)
+		resources.Limits = mergeResources(resources.Limits, explicit.Limits)
+	}
+	return resources
+}
+
+// mergeResources returns a copy of base with the quantities in override
+// added or replaced. It returns nil rather than an empty list.
+func mergeResources(base, override corev1.ResourceList) corev1.ResourceList {
+	if len(base) == 0 && len(override) == 0 {
+		return nil
+	}
+	merged := corev1.ResourceList{}
+	for name, quantity := range base {
+		merged[name] = quantity.DeepCopy()
+	}
+	for name, quantity := range override {
+		merged[name] = quantity.DeepCopy()
+	}
+	return merged
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// reconcileStatefulSetWorkload runs the Webserver's pods from its
+// StatefulSet, like reconcileDaemonSetWorkload does from a DaemonSet.
+func (r *WebserverReconciler) reconcileStatefulSetWorkload(ctx context.Context, instance *serversv1alpha1.Webserver, desired *manifests, namespace string, now time.Time) (backoff, stableAfter time.Duration, err error) {
+	statefulSet, err := r.reconcileStatefulSet(ctx, instance, desired.StatefulSet)
+	setAppliedCondition(instance, serversv1alpha1.ConditionStatefulSetApplied, err)
+	if err != nil {
+		return 0, 0, err
+	}
+	if err := r.deleteOtherWorkloads(ctx, instance, namespace); err != nil {
+		return 0, 0, err
+	}
+	for _, service := range desired.Services {
+		service.Spec.Selector = statefulSet.Spec.Selector.MatchLabels
+	}
+	instance.Status.SelectorLabels = copyStringMap(statefulSet.Spec.Selector.MatchLabels)
+
+	pods, err := r.listPods(ctx, statefulSet.Namespace, statefulSet.Spec.Selector.MatchLabels)
+	if err != nil {
+		return 0, 0, err
+	}
+	instance.Status.Summary = podSummary(pods)
+	instance.Status.Pods = podInfos(pods)
+	if imageID := runningImageID(pods); imageID != "" {
+		instance.Status.ImageID = imageID
+	}
+	instance.Status.Phase = statefulSetPhase(statefulSet, pods)
+	setDegradedCondition(instance, pods, false)
+	return crashLoopRequeue(ctx, pods), setStableCondition(instance, statefulSetReady(statefulSet), now), nil
+}
+
+// reconcileStatefulSet creates or updates the Webserver's StatefulSet to
+// match the desired one. Its selector, Service name and volume claim
+// templates cannot change, so they are only set when it is created.
+func (r *WebserverReconciler) reconcileStatefulSet(ctx context.Context, instance *serversv1alpha1.Webserver, desired *appsv1.StatefulSet) (*appsv1.StatefulSet, error) {
+	var statefulSet *appsv1.StatefulSet
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		statefulSet = &appsv1.StatefulSet{ObjectMeta: metav1.ObjectMeta{Name: desired.Name, Namespace: desired.Namespace}}
+		op, err = r.createOrUpdate(ctx, statefulSet, func() error {
+			liveVersion = statefulSet.ResourceVersion
+			if statefulSet.CreationTimestamp.IsZero() {
+				statefulSet.Spec.Selector = desired.Spec.Selector
+				statefulSet.Spec.ServiceName = desired.Spec.ServiceName
+				statefulSet.Spec.VolumeClaimTemplates = desired.Spec.VolumeClaimTemplates
+			}
+			statefulSet.Labels = desired.Labels
+			statefulSet.Spec.Replicas = desired.Spec.Replicas
+			if cause, ok := desired.Annotations[changeCauseAnnotation]; ok {
+				if statefulSet.Annotations == nil {
+					statefulSet.Annotations = map[string]string{}
+				}
+				statefulSet.Annotations[changeCauseAnnotation] = cause
+			} else {
+				delete(statefulSet.Annotations, changeCauseAnnotation)
+			}
+			template := liveTemplate(&desired.Spec.Template, &statefulSet.Spec.Template, statefulSet.Spec.Selector)
+			// Storage added after the StatefulSet was created has no claim
+			// template to back the mount, which the API server would reject.
+			if !hasClaimTemplate(statefulSet, dataVolumeName) {
+				removeVolumeMount(template, dataVolumeName)
+			}
+			applyTemplate(statefulSet, &statefulSet.Spec.Template, template)
+			return r.setOwner(instance, statefulSet)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "StatefulSet", desired.Name, liveVersion, statefulSet.ResourceVersion, err)
+	if err != nil {
+		return nil, err
+	}
+	log.FromContext(ctx).V(1).Info("Reconciled StatefulSet", "statefulSet", statefulSet.Name, "operation", op)
+	recordApplied(&instance.Status.Resources.StatefulSet, liveVersion, statefulSet.ResourceVersion)
+	return statefulSet, nil
+}
+
+// statefulSetPhase derives the Webserver's phase from its StatefulSet and
+// pods.
+func statefulSetPhase(statefulSet *appsv1.StatefulSet, pods []corev1.Pod) serversv1alpha1.WebserverPhase {
+	for i := range pods {
+		if podCrashLooping(&pods[i]) {
+			return serversv1alpha1.PhaseDegraded
+		}
+	}
+	if statefulSet.Status.ObservedGeneration == 0 {
+		return serversv1alpha1.PhasePending
+	}
+	if statefulSetReady(statefulSet) {
+		return serversv1alpha1.PhaseReady
+	}
+	return serversv1alpha1.PhaseProgressing
+}
+
+// statefulSetReady reports whether the StatefulSet controller has observed
+// the current generation and every desired replica is ready and runs the
+// current revision.
+func statefulSetReady(statefulSet *appsv1.StatefulSet) bool {
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	return status.ObservedGeneration >= statefulSet.Generation &&
+		status.ReadyReplicas == replicas &&
+		status.UpdatedReplicas == replicas
+}
+
+// hasClaimTemplate reports whether the StatefulSet has a volume claim
+// template named name.
+func hasClaimTemplate(statefulSet *appsv1.StatefulSet, name string) bool {
+	for _, claim := range statefulSet.Spec.VolumeClaimTemplates {
+		if claim.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// removeVolumeMount removes the mounts of the volume name from the
+// template's containers.
+func removeVolumeMount(template *corev1.PodTemplateSpec, name string) {
+	for i := range template.Spec.Containers {
+		container := &template.Spec.Containers[i]
+		mounts := container.VolumeMounts[:0]
+		for _, mount := range container.VolumeMounts {
+			if mount.Name != name {
+				mounts = append(mounts, mount)
+			}
+		}
+		container.VolumeMounts = mounts
+	}
+}
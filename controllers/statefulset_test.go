@@ -0,0 +1,70 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("StatefulSet storage", func() {
+	It("does not mount storage added after the StatefulSet was created", func() {
+		ctx := context.Background()
+		count := int32(1)
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+			Spec: serversv1alpha1.WebserverSpec{
+				Count:        &count,
+				WorkloadType: serversv1alpha1.WorkloadStatefulSet,
+			},
+		}
+		r := newFakeReconciler(instance)
+		r.setDefaults()
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)}
+		_, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		// The fake client does not stamp the creation time the API server
+		// would.
+		created := &appsv1.StatefulSet{}
+		Expect(r.Client.Get(ctx, req.NamespacedName, created)).To(Succeed())
+		created.CreationTimestamp = metav1.Now()
+		Expect(r.Client.Update(ctx, created)).To(Succeed())
+
+		instance = &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, req.NamespacedName, instance)).To(Succeed())
+		instance.Spec.Storage = &serversv1alpha1.WebserverStorage{Size: resource.MustParse("1Gi")}
+		Expect(r.Client.Update(ctx, instance)).To(Succeed())
+		_, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		statefulSet := &appsv1.StatefulSet{}
+		Expect(r.Client.Get(ctx, req.NamespacedName, statefulSet)).To(Succeed())
+		Expect(statefulSet.Spec.VolumeClaimTemplates).To(BeEmpty())
+		for _, mount := range statefulSet.Spec.Template.Spec.Containers[0].VolumeMounts {
+			Expect(mount.Name).NotTo(Equal(dataVolumeName))
+		}
+	})
+})
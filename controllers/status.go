@@ -0,0 +1,252 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// defaultStableAfter is how long replicas must stay ready before the Stable
+// condition becomes True when the Webserver does not set StableAfter.
+const defaultStableAfter = 5 * time.Minute
+
+// recordApplied stamps the resource's LastAppliedTime when a write actually
+// changed the object. An update that the API server treats as a no-op keeps
+// the same resourceVersion and is not recorded.
+func recordApplied(status *serversv1alpha1.ResourceStatus, before, after string) {
+	if after == "" || before == after {
+		return
+	}
+	now := metav1.Now()
+	status.LastAppliedTime = &now
+}
+
+// recordAction records in the Webserver's status what the reconcile did to
+// the owned object kind/name, given its resourceVersion before and after the
+// write and the write's error, and adds it to the reconcile's report. The
+// time only moves for writes and for changes of action, so that repeated
+// no-op or failing reconciles do not update the status, which would trigger
+// another reconcile.
+func recordAction(ctx context.Context, instance *serversv1alpha1.Webserver, kind, name, before, after string, err error) {
+	action := serversv1alpha1.ActionUnchanged
+	switch {
+	case err != nil:
+		action = serversv1alpha1.ActionFailed
+	case before == "":
+		action = serversv1alpha1.ActionCreated
+	case before != after:
+		action = serversv1alpha1.ActionUpdated
+	}
+
+	reportObject(ctx, ObjectReport{Kind: kind, Name: name, Action: action, Err: err})
+
+	key := kind + "/" + name
+	previous, ok := instance.Status.Objects[key]
+	if ok && previous.Action == action && (action == serversv1alpha1.ActionUnchanged || action == serversv1alpha1.ActionFailed) {
+		return
+	}
+	if instance.Status.Objects == nil {
+		instance.Status.Objects = map[string]serversv1alpha1.ObjectAction{}
+	}
+	instance.Status.Objects[key] = serversv1alpha1.ObjectAction{Action: action, Time: metav1.Now()}
+}
+
+// pruneActions drops the recorded actions of objects the Webserver no
+// longer manages.
+func pruneActions(instance *serversv1alpha1.Webserver, desired *manifests) {
+	keep := map[string]bool{}
+	switch {
+	case desired.DaemonSet != nil:
+		keep["DaemonSet/"+desired.DaemonSet.Name] = true
+	case desired.StatefulSet != nil:
+		keep["StatefulSet/"+desired.StatefulSet.Name] = true
+	default:
+		keep["Deployment/"+desired.Deployment.Name] = true
+	}
+	for _, service := range desired.Services {
+		keep["Service/"+service.Name] = true
+	}
+	if desired.Route != nil {
+		keep["Route/"+desired.Route.Name] = true
+	}
+	if desired.HTTPRoute != nil {
+		keep["HTTPRoute/"+desired.HTTPRoute.GetName()] = true
+	}
+	if desired.Ingress != nil {
+		keep["Ingress/"+desired.Ingress.Name] = true
+	}
+	for _, configMap := range desired.ConfigMaps {
+		keep["ConfigMap/"+configMap.Name] = true
+	}
+	if desired.PrometheusRule != nil {
+		keep["PrometheusRule/"+desired.PrometheusRule.GetName()] = true
+	}
+	for _, obj := range desired.Extra {
+		keep[obj.GetKind()+"/"+obj.GetName()] = true
+	}
+	for key := range instance.Status.Objects {
+		if !keep[key] {
+			delete(instance.Status.Objects, key)
+		}
+	}
+	if len(instance.Status.Objects) == 0 {
+		instance.Status.Objects = nil
+	}
+}
+
+// webserverPhase derives the Webserver's phase from its Deployment and pods.
+func webserverPhase(deployment *appsv1.Deployment, pods []corev1.Pod) serversv1alpha1.WebserverPhase {
+	if rolloutDegraded(deployment) {
+		return serversv1alpha1.PhaseDegraded
+	}
+	for i := range pods {
+		if podCrashLooping(&pods[i]) {
+			return serversv1alpha1.PhaseDegraded
+		}
+	}
+	if deployment.Spec.Paused {
+		return serversv1alpha1.PhasePaused
+	}
+	if deployment.Status.ObservedGeneration == 0 {
+		return serversv1alpha1.PhasePending
+	}
+	if rolloutComplete(deployment) {
+		return serversv1alpha1.PhaseReady
+	}
+	return serversv1alpha1.PhaseProgressing
+}
+
+// setAppliedCondition records whether the operator could apply one of the
+// Webserver's owned objects.
+func setAppliedCondition(instance *serversv1alpha1.Webserver, conditionType string, err error) {
+	condition := metav1.Condition{
+		Type:               conditionType,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Applied",
+	}
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ApplyFailed"
+		condition.Message = err.Error()
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
+
+// setSelectorCondition reports whether the live Deployment's selector matches
+// the desired one. Selectors are immutable, so a mismatch is only reported.
+func setSelectorCondition(instance *serversv1alpha1.Webserver, live, desired *appsv1.Deployment) {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionSelectorUpToDate,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Matches",
+	}
+	if !equality.Semantic.DeepEqual(live.Spec.Selector, desired.Spec.Selector) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "SelectorImmutable"
+		condition.Message = fmt.Sprintf("Deployment selector %s cannot be changed to %s; recreate the Webserver to apply new selector labels",
+			metav1.FormatLabelSelector(live.Spec.Selector), metav1.FormatLabelSelector(desired.Spec.Selector))
+		if instance.Spec.RecreateOnSelectorChange {
+			condition.Reason = "WaitingForPodLabels"
+			condition.Message = fmt.Sprintf("Deployment will be recreated with selector %s once all its pods carry those labels; add them to spec.podLabels first",
+				metav1.FormatLabelSelector(desired.Spec.Selector))
+		}
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
+
+// setDegradedCondition records whether the rollout has timed out, as
+// reported by deadlineExceeded, or pods are crash looping.
+func setDegradedCondition(instance *serversv1alpha1.Webserver, pods []corev1.Pod, deadlineExceeded bool) {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionDegraded,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "AsExpected",
+	}
+	if message, _, ok := crashLoop(pods); ok {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = crashLoopBackOffReason
+		condition.Message = message
+	} else if deadlineExceeded {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = progressDeadlineExceededReason
+		condition.Message = "Deployment rollout exceeded its progress deadline"
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+}
+
+// setStableCondition records how long every replica of the workload has
+// been ready, as reported by ready, and whether that is at least the
+// Webserver's StableAfter. While the replicas are ready but not yet stable,
+// it returns how long until the condition should flip, and zero otherwise.
+func setStableCondition(instance *serversv1alpha1.Webserver, ready bool, now time.Time) time.Duration {
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionStable,
+		Status:             metav1.ConditionFalse,
+		ObservedGeneration: instance.Generation,
+		Reason:             "NotReady",
+		Message:            "Not every replica is ready",
+	}
+	defer func() { meta.SetStatusCondition(&instance.Status.Conditions, condition) }()
+
+	if !ready {
+		instance.Status.ReadySince = nil
+		return 0
+	}
+	if instance.Status.ReadySince == nil {
+		since := metav1.NewTime(now)
+		instance.Status.ReadySince = &since
+	}
+
+	stableAfter := defaultStableAfter
+	if instance.Spec.StableAfter != nil {
+		stableAfter = instance.Spec.StableAfter.Duration
+	}
+	remaining := instance.Status.ReadySince.Add(stableAfter).Sub(now)
+	if remaining > 0 {
+		condition.Reason = "Stabilizing"
+		condition.Message = fmt.Sprintf("All replicas ready since %s; stable after %s", instance.Status.ReadySince.UTC().Format(time.RFC3339), stableAfter)
+		return remaining
+	}
+	condition.Status = metav1.ConditionTrue
+	condition.Reason = "StablyReady"
+	condition.Message = fmt.Sprintf("All replicas ready since %s", instance.Status.ReadySince.UTC().Format(time.RFC3339))
+	return 0
+}
+
+// replicasReady reports whether the Deployment controller has observed the
+// current generation and every desired replica is ready.
+func replicasReady(deployment *appsv1.Deployment) bool {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.ReadyReplicas == replicas
+}
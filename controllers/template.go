@@ -0,0 +1,136 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sigs.k8s.io/yaml"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// defaultTemplateKey is the ConfigMap key read when a TemplateRef does not
+// name one.
+const defaultTemplateKey = "template.yaml"
+
+// applyBaseTemplate overlays the desired Deployment's pod template onto the
+// base template named by the Webserver's TemplateRef and records the
+// outcome in the TemplateApplied condition. A missing ConfigMap or key
+// leaves the generated template as is; a template that does not parse
+// fails the reconcile, so the pods are not rolled away from the standard
+// by a typo.
+func (r *WebserverReconciler) applyBaseTemplate(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) error {
+	ref := instance.Spec.TemplateRef
+	if ref == nil {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionTemplateApplied)
+		return nil
+	}
+	key := ref.Key
+	if key == "" {
+		key = defaultTemplateKey
+	}
+
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionTemplateApplied,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Applied",
+	}
+	defer func() { meta.SetStatusCondition(&instance.Status.Conditions, condition) }()
+
+	configMap := &corev1.ConfigMap{}
+	err := r.Client.Get(ctx, types.NamespacedName{Name: ref.Name, Namespace: deployment.Namespace}, configMap)
+	if errors.IsNotFound(err) {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("ConfigMap %s/%s does not exist; using the built-in pod template", deployment.Namespace, ref.Name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	data, ok := configMap.Data[key]
+	if !ok {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "NotFound"
+		condition.Message = fmt.Sprintf("ConfigMap %s/%s has no key %s; using the built-in pod template", deployment.Namespace, ref.Name, key)
+		return nil
+	}
+
+	template, err := overlayTemplate([]byte(data), &deployment.Spec.Template)
+	if err != nil {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Invalid"
+		condition.Message = fmt.Sprintf("ConfigMap %s/%s key %s: %v", deployment.Namespace, ref.Name, key, err)
+		return fmt.Errorf("applying base template: %w", err)
+	}
+	deployment.Spec.Template = *template
+	return nil
+}
+
+// overlayTemplate parses base, a Deployment or PodSpec manifest, and
+// strategically merges template onto its pod template, so that containers
+// and volumes are merged by name and template's fields win.
+func overlayTemplate(base []byte, template *corev1.PodTemplateSpec) (*corev1.PodTemplateSpec, error) {
+	var typeMeta metav1.TypeMeta
+	if err := yaml.Unmarshal(base, &typeMeta); err != nil {
+		return nil, err
+	}
+	baseTemplate := &corev1.PodTemplateSpec{}
+	switch typeMeta.Kind {
+	case "Deployment":
+		d := &appsv1.Deployment{}
+		if err := yaml.UnmarshalStrict(base, d); err != nil {
+			return nil, err
+		}
+		baseTemplate = &d.Spec.Template
+	case "":
+		if err := yaml.UnmarshalStrict(base, &baseTemplate.Spec); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("template must be a Deployment or a PodSpec, not a %s", typeMeta.Kind)
+	}
+
+	original, err := json.Marshal(baseTemplate)
+	if err != nil {
+		return nil, err
+	}
+	patch, err := json.Marshal(template)
+	if err != nil {
+		return nil, err
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, patch, corev1.PodTemplateSpec{})
+	if err != nil {
+		return nil, err
+	}
+	result := &corev1.PodTemplateSpec{}
+	if err := json.Unmarshal(merged, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
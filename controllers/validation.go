@@ -0,0 +1,44 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// setSpecCondition validates the Webserver's spec, as the validating
+// webhook would, and reports the problems in the InvalidSpec condition. It
+// returns the problems, or nil when the spec is valid.
+func setSpecCondition(instance *serversv1alpha1.Webserver) error {
+	errs := instance.ValidateSpec()
+	if len(errs) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionInvalidSpec)
+		return nil
+	}
+	err := errs.ToAggregate()
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               serversv1alpha1.ConditionInvalidSpec,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "ValidationFailed",
+		Message:            err.Error(),
+	})
+	return err
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// OperatorVersion is the version of the running operator, recorded on every
+// Webserver it fully reconciles. Builds set it with
+// -ldflags "-X github.com/jacobsee/sample-operator/controllers.OperatorVersion=<version>".
+var OperatorVersion = "dev"
+
+// setOperatorVersion records that the running operator version reconciled
+// the Webserver without errors.
+func setOperatorVersion(instance *serversv1alpha1.Webserver) {
+	instance.Status.OperatorVersion = OperatorVersion
+	meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+		Type:               serversv1alpha1.ConditionOperatorUpToDate,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "Reconciled",
+		Message:            fmt.Sprintf("Reconciled by operator version %s", OperatorVersion),
+	})
+}
+
+// outdatedMarker sets OperatorUpToDate to False on the Webservers last
+// reconciled by another operator version when the operator starts, so the
+// condition shows which of them the new version has not reconciled yet.
+type outdatedMarker struct {
+	client client.Client
+}
+
+// Start implements manager.Runnable. It runs once and returns.
+func (m *outdatedMarker) Start(ctx context.Context) error {
+	logger := log.FromContext(ctx).WithName("operator-version")
+	list := &serversv1alpha1.WebserverList{}
+	if err := m.client.List(ctx, list); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		instance := &list.Items[i]
+		previous := instance.Status.OperatorVersion
+		if previous == "" || previous == OperatorVersion {
+			continue
+		}
+		// The optimistic lock keeps this from overwriting the status of a
+		// Webserver the new version has reconciled in the meantime.
+		patch := client.MergeFromWithOptions(instance.DeepCopy(), client.MergeFromWithOptimisticLock{})
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionOperatorUpToDate,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: instance.Generation,
+			Reason:             "OperatorUpgraded",
+			Message:            fmt.Sprintf("Last reconciled by operator version %s; waiting for version %s", previous, OperatorVersion),
+		})
+		err := m.client.Status().Patch(ctx, instance, patch)
+		if err != nil && !errors.IsConflict(err) && !errors.IsNotFound(err) {
+			logger.Error(err, "Marking Webserver as reconciled by another operator version", "webserver", client.ObjectKeyFromObject(instance))
+		}
+	}
+	return nil
+}
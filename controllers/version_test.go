@@ -0,0 +1,58 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+var _ = Describe("Operator version", func() {
+	It("records the version on Webservers in observe mode", func() {
+		ctx := context.Background()
+		instance := &serversv1alpha1.Webserver{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "web",
+				Namespace:   "default",
+				Annotations: map[string]string{reconcileModeAnnotation: reconcileModeObserve},
+			},
+		}
+		instance.Status.OperatorVersion = "old"
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:   serversv1alpha1.ConditionOperatorUpToDate,
+			Status: metav1.ConditionFalse,
+			Reason: "OperatorUpgraded",
+		})
+		r := newFakeReconciler(instance)
+		r.setDefaults()
+
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(instance)})
+		Expect(err).NotTo(HaveOccurred())
+		got := &serversv1alpha1.Webserver{}
+		Expect(r.Client.Get(ctx, client.ObjectKeyFromObject(instance), got)).To(Succeed())
+		Expect(got.Status.OperatorVersion).To(Equal(OperatorVersion))
+		Expect(meta.IsStatusConditionTrue(got.Status.Conditions, serversv1alpha1.ConditionOperatorUpToDate)).To(BeTrue())
+	})
+})
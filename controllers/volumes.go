@@ -0,0 +1,98 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// setVolumesCondition records in the VolumesShareable condition whether
+// every PersistentVolumeClaim the desired Deployment's pods mount supports
+// its replica count. Claims that do not exist yet are skipped.
+func (r *WebserverReconciler) setVolumesCondition(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) error {
+	var claims []string
+	for _, volume := range deployment.Spec.Template.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			claims = append(claims, volume.PersistentVolumeClaim.ClaimName)
+		}
+	}
+	if len(claims) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionVolumesShareable)
+		return nil
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	var exclusive []string
+	for _, name := range claims {
+		claim := &corev1.PersistentVolumeClaim{}
+		err := r.Client.Get(ctx, types.NamespacedName{Name: name, Namespace: deployment.Namespace}, claim)
+		switch {
+		case errors.IsNotFound(err):
+			continue
+		case err != nil:
+			return err
+		}
+		if replicas > 1 && !shareable(claim) {
+			exclusive = append(exclusive, name)
+		}
+	}
+
+	condition := metav1.Condition{
+		Type:               serversv1alpha1.ConditionVolumesShareable,
+		Status:             metav1.ConditionTrue,
+		ObservedGeneration: instance.Generation,
+		Reason:             "AccessModesCompatible",
+	}
+	if len(exclusive) > 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "ReadWriteOnce"
+		condition.Message = fmt.Sprintf("PersistentVolumeClaim %s only supports ReadWriteOnce, so not all %d replicas may be able to mount it; use a ReadWriteMany or ReadOnlyMany claim",
+			strings.Join(exclusive, ", "), replicas)
+	}
+	meta.SetStatusCondition(&instance.Status.Conditions, condition)
+	return nil
+}
+
+// shareable reports whether a claim can be mounted by pods on several
+// nodes. The access modes of the bound volume take precedence over the
+// requested ones.
+func shareable(claim *corev1.PersistentVolumeClaim) bool {
+	modes := claim.Status.AccessModes
+	if len(modes) == 0 {
+		modes = claim.Spec.AccessModes
+	}
+	for _, mode := range modes {
+		if mode == corev1.ReadWriteMany || mode == corev1.ReadOnlyMany {
+			return true
+		}
+	}
+	return false
+}
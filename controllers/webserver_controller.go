@@ -18,19 +18,36 @@ package controllers
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"os"
+	"time"
 
+	"github.com/google/go-cmp/cmp"
 	routev1 "github.com/openshift/api/route/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
 )
@@ -39,11 +56,130 @@ import (
 type WebserverReconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+
+	// Recorder emits events about Webservers. Events are not emitted when
+	// it is nil.
+	Recorder record.EventRecorder
+
+	// OnReconcile, when set, is called after every reconcile with a report
+	// of what it did. Tests use it to assert on the writes a reconcile made.
+	OnReconcile func(ReconcileReport)
+
+	// EnableSelfHeal allows Webservers that request a SelfHeal policy to have
+	// their degraded rollouts restarted or rolled back.
+	EnableSelfHeal bool
+
+	// MaxRollbackAttempts caps the automatic rollbacks of a Webserver
+	// between completed rollouts of its own pod template. Zero means no
+	// limit.
+	MaxRollbackAttempts int32
+
+	// Cooldown is the minimum interval between reconciles of the same
+	// Webserver. Zero disables the cooldown.
+	Cooldown time.Duration
+
+	// FieldManager is the field manager name for every write the reconciler
+	// makes, and the value of the app.kubernetes.io/managed-by label on
+	// owned objects. It defaults to DefaultFieldManager.
+	FieldManager string
+
+	// CleanupHook is run when a Webserver is deleted. It defaults to
+	// NoopCleanupHook.
+	CleanupHook CleanupHook
+
+	// Finalizer is the name of the finalizer that holds a deleted Webserver
+	// until CleanupHook has run. It defaults to DefaultFinalizer.
+	Finalizer string
+
+	// FinalizeAfter lists finalizers of other controllers that must be
+	// removed from a deleted Webserver before the operator cleans up and
+	// removes its own.
+	FinalizeAfter []string
+
+	// Builders add objects to, or change, the objects each Webserver owns.
+	// They run in order after the built-in objects are rendered, unless
+	// they include a DefaultResourceBuilder to place the rendering
+	// elsewhere. Builders passed to SetupWithManager are appended.
+	Builders []ResourceBuilder
+
+	// MaxConcurrentReconciles is the number of Webservers reconciled in
+	// parallel. It defaults to 1.
+	MaxConcurrentReconciles int
+
+	// MaxConcurrentChecksPerNamespace bounds the reachability checks running
+	// at once for Webservers in the same namespace. Zero means no limit.
+	MaxConcurrentChecksPerNamespace int
+
+	// CircuitBreakerThreshold is the number of reconciles in a row that may
+	// fail with API server errors before all reconciles are held off for
+	// CircuitBreakerCooldown. Zero disables the circuit breaker.
+	CircuitBreakerThreshold int
+
+	// CircuitBreakerCooldown is how long reconciles are held off once the
+	// circuit breaker opens.
+	CircuitBreakerCooldown time.Duration
+
+	// SidecarTemplates names a ConfigMap whose entries are YAML lists of
+	// containers. Pods running in a namespace labelled
+	// servers.redhat.com/sidecar-injection get the containers of the entry
+	// the label names. Sidecar injection is disabled when unset.
+	SidecarTemplates types.NamespacedName
+
+	// ObserveOnly reports drift of every Webserver's owned objects in the
+	// Drifted condition instead of correcting it. Webservers annotated with
+	// servers.redhat.com/reconcile-mode: Observe are observed regardless.
+	ObserveOnly bool
+
+	// RollOutDefaultImage rolls Webservers that rely on the default image out
+	// to a changed DefaultImage when the operator starts. Otherwise they keep
+	// the default they were last rolled out with until their spec changes.
+	RollOutDefaultImage bool
+
+	// RecreateDelay is how long Services, Routes, HTTPRoutes and Ingresses
+	// deleted outside the operator stay deleted before they are recreated,
+	// giving admins a window for maintenance. Webservers can override it
+	// with the servers.redhat.com/recreate-delay annotation. Zero recreates
+	// them straight away.
+	RecreateDelay time.Duration
+
+	cooldown  *cooldown
+	holds     *recreateHolds
+	checks    *namespaceLimiter
+	breaker   *circuitBreaker
+	apiReader client.Reader
+
+	// secretDigests is only set with a manager, whose cache holds the
+	// Secret metadata it is checked against.
+	secretDigests *secretDigests
+
+	// migrated is closed once the count migration has run. Reconciles wait
+	// for it; it is nil when there is nothing to wait for.
+	migrated <-chan struct{}
+
+	// creating is set on the copy of the reconciler used for a Webserver
+	// that owns nothing yet, whose objects are created without first being
+	// read and without cleaning up objects it cannot have.
+	creating bool
 }
 
 //+kubebuilder:rbac:groups=servers.redhat.com,resources=webservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=servers.redhat.com,resources=webservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=servers.redhat.com,resources=webservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=daemonsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=pods,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups=core,resources=persistentvolumeclaims,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=services,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=route.openshift.io,resources=routes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=monitoring.coreos.com,resources=prometheusrules,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -57,123 +193,754 @@ type WebserverReconciler struct {
 func (r *WebserverReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
 
-	logger.Info("Reconciling Webserver")
+	if r.migrated != nil {
+		select {
+		case <-r.migrated:
+		case <-ctx.Done():
+			return ctrl.Result{}, ctx.Err()
+		}
+	}
+	if d := r.breaker.wait(); d > 0 {
+		logger.V(1).Info("Circuit breaker open, holding off reconcile", "requeueAfter", d)
+		return ctrl.Result{RequeueAfter: d}, nil
+	}
+	var report *ReconcileReport
+	if r.OnReconcile != nil {
+		report = &ReconcileReport{Request: req}
+		ctx = withReport(ctx, report)
+	}
+	result, err := r.reconcile(ctx, req)
+	if r.breaker.record(err) {
+		logger.Info("API server errors keep failing reconciles, holding off all reconciles", "cooldown", r.CircuitBreakerCooldown, "error", err.Error())
+	}
+	if report != nil {
+		report.Result, report.Err = result, err
+		r.OnReconcile(*report)
+	}
+	return result, err
+}
 
+// reconcile brings the Webserver's owned objects and status up to date.
+func (r *WebserverReconciler) reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	instance := &serversv1alpha1.Webserver{}
 	err := r.Client.Get(ctx, req.NamespacedName, instance)
 	if err != nil {
 		if errors.IsNotFound(err) {
-			return ctrl.Result{}, nil
+			r.cooldown.forget(req.NamespacedName)
+			r.holds.forget(req.NamespacedName)
+			routeHostChanges.DeleteLabelValues(req.Namespace, req.Name)
+			return ctrl.Result{}, r.forgetUnreferencedSecrets(ctx)
 		}
 		return ctrl.Result{}, err
 	}
 
-	labels := map[string]string{"app": instance.Name}
-	deployment := &appsv1.Deployment{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      instance.Name,
-			Namespace: instance.Namespace,
-		},
-		Spec: appsv1.DeploymentSpec{
-			Replicas: &instance.Spec.Count,
-			Selector: &metav1.LabelSelector{
-				MatchLabels: labels,
-			},
-			Template: corev1.PodTemplateSpec{
-				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
-				},
-				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{
-						{
-							Name:  "webserver",
-							Image: "registry.access.redhat.com/rhscl/httpd-24-rhel7:latest",
-							Ports: []corev1.ContainerPort{
-								{
-									Name:          "http",
-									ContainerPort: 8080,
-								},
-							},
-						},
-					},
-				},
-			},
-		},
+	ctx = withCorrelationID(ctx, instance)
+	logger := log.FromContext(ctx)
+	logger.Info("Reconciling Webserver")
+
+	if !instance.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, r.finalize(ctx, instance)
+	}
+	// In observe mode the reconcile runs as usual against a client that
+	// turns every write into a dry run.
+	if _, observing := r.Client.(*observingClient); !observing && r.observing(instance) {
+		observer := *r
+		observer.Client = newObservingClient(r.Client)
+		return observer.reconcile(ctx, req)
+	}
+	if err := r.ensureFinalizer(ctx, instance); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if d := r.cooldown.wait(req.NamespacedName); d > 0 {
+		logger.V(1).Info("Reconcile cooldown in effect", "requeueAfter", d)
+		return ctrl.Result{RequeueAfter: d}, nil
+	}
+
+	status := instance.Status.DeepCopy()
+
+	// Without the validating webhook an invalid spec reaches the
+	// controller, and applying it would only produce broken objects.
+	if invalid := setSpecCondition(instance); invalid != nil {
+		logger.Info("Webserver spec is invalid, leaving its objects as they are", "error", invalid.Error())
+		if instance.Status.Phase == "" {
+			instance.Status.Phase = serversv1alpha1.PhasePending
+		}
+		return ctrl.Result{}, r.updateStatusIfChanged(ctx, status, instance)
+	}
+
+	namespace := targetNamespace(instance)
+	if previous := instance.Status.TargetNamespace; previous != "" && previous != namespace {
+		logger.Info("Target namespace changed, removing resources from previous namespace", "namespace", previous)
+		if err := r.deleteOwnedObjects(ctx, instance, previous); err != nil {
+			return ctrl.Result{}, err
+		}
 	}
 
-	if err := controllerutil.SetControllerReference(instance, deployment, r.Scheme); err != nil {
+	// A new Webserver is the common case: create its objects without the
+	// reads and cleanup that only matter once something exists.
+	if fresh, err := r.ownsNothing(ctx, instance, namespace); err != nil {
 		return ctrl.Result{}, err
+	} else if fresh {
+		logger.V(1).Info("Webserver owns no objects yet, creating them")
+		reconcileFastPath.Inc()
+		creator := *r
+		creator.creating = true
+		r = &creator
 	}
 
-	err = r.Client.Create(context.TODO(), deployment)
+	desired, err := r.buildManifests(instance)
 	if err != nil {
-		err = r.Client.Update(context.TODO(), deployment)
-		if err != nil {
-			return ctrl.Result{}, err
+		return ctrl.Result{}, err
+	}
+	if image, mirrored := mirrorImage(sourceImage(instance)); mirrored {
+		logger.V(1).Info("Pulling image from registry mirror", "image", sourceImage(instance), "mirror", image)
+	}
+
+	scaleAfter, err := applyScaleSchedule(instance, desired.Deployment, time.Now())
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	if err := r.applyBaseTemplate(ctx, instance, desired.Deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	applySpreadAcrossNodes(instance, &desired.Deployment.Spec.Template)
+	tolerationsAfter := applyTemporaryTolerations(instance, &desired.Deployment.Spec.Template, time.Now())
+	// Without the checksum the pod template would change and roll the pods,
+	// so give up on this reconcile if the ConfigMap cannot be read.
+	if err := r.applyConfigChecksum(ctx, instance, desired.Deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.injectSidecars(ctx, desired.Deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.applySecretChecksum(ctx, desired.Deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	r.pinDefaultImage(ctx, instance, desired.Deployment)
+	if err := applyEffectiveConfigChecksum(desired.Deployment); err != nil {
+		return ctrl.Result{}, err
+	}
+	desired.copyPodTemplate()
+
+	// A Deployment whose pods reference missing objects would only produce
+	// pods stuck in ContainerCreating, so leave the owned objects alone until
+	// the dependencies exist.
+	missing, err := r.missingDependencies(ctx, instance, namespace)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	setDependencyCondition(instance, missing)
+	if len(missing) > 0 {
+		logger.Info("Waiting for dependencies", "missing", missing)
+		if instance.Status.Phase == "" {
+			instance.Status.Phase = serversv1alpha1.PhasePending
 		}
+		return ctrl.Result{RequeueAfter: dependencyRequeueAfter}, r.updateStatusIfChanged(ctx, status, instance)
 	}
 
-	service := &corev1.Service{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      instance.Name,
-			Namespace: instance.Namespace,
-		},
-		Spec: corev1.ServiceSpec{
-			Selector: labels,
-			Ports: []corev1.ServicePort{
-				{
-					Name:     "http",
-					Protocol: "TCP",
-					Port:     8080,
-				},
-			},
-		},
+	if err := r.setVolumesCondition(ctx, instance, desired.Deployment); err != nil {
+		return ctrl.Result{}, err
 	}
 
-	if err := controllerutil.SetControllerReference(instance, service, r.Scheme); err != nil {
+	recreating, err := r.recreateForSelector(ctx, instance, desired.Deployment)
+	if err != nil {
 		return ctrl.Result{}, err
 	}
+	if recreating {
+		meta.SetStatusCondition(&instance.Status.Conditions, metav1.Condition{
+			Type:               serversv1alpha1.ConditionSelectorUpToDate,
+			Status:             metav1.ConditionFalse,
+			ObservedGeneration: instance.Generation,
+			Reason:             "Recreating",
+			Message:            "Replacing the Deployment to apply the new selector; its pods keep running",
+		})
+		return ctrl.Result{RequeueAfter: selectorRecreateRequeue}, r.updateStatusIfChanged(ctx, status, instance)
+	}
 
-	err = r.Client.Create(context.TODO(), service)
+	// Objects someone deleted are left out of desired while held, but their
+	// recorded actions are kept so the hold continues on later reconciles.
+	all := *desired
+	holdAfter, err := r.holdDeletedObjects(ctx, instance, desired, time.Now())
 	if err != nil {
 		return ctrl.Result{}, err
 	}
 
-	route := &routev1.Route{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      instance.Name,
-			Namespace: instance.Namespace,
-			Labels:    labels,
-		},
-		Spec: routev1.RouteSpec{
-			To: routev1.RouteTargetReference{
-				Kind: "Service",
-				Name: instance.Name,
+	var errs []error
+	var requeueAfter time.Duration
+
+	// ExtraConfigMaps go first, so pods mounting them can start.
+	if err := r.reconcileExtraConfigMaps(ctx, instance, desired.ConfigMaps, namespace); err != nil {
+		errs = append(errs, err)
+	}
+
+	// Each owned object is applied independently so that one failure does
+	// not hide the state of the others; the errors are returned together.
+	var deployment *appsv1.Deployment
+	var stableAfter time.Duration
+	switch {
+	case desired.DaemonSet != nil:
+		requeueAfter, stableAfter, err = r.reconcileDaemonSetWorkload(ctx, instance, desired, namespace, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	case desired.StatefulSet != nil:
+		requeueAfter, stableAfter, err = r.reconcileStatefulSetWorkload(ctx, instance, desired, namespace, time.Now())
+		if err != nil {
+			errs = append(errs, err)
+		}
+	default:
+		deployment, err = r.reconcileDeployment(ctx, instance, desired.Deployment)
+		setAppliedCondition(instance, serversv1alpha1.ConditionDeploymentApplied, err)
+		if err == nil {
+			// Workloads left from before a switch to a Deployment are only
+			// removed once the Deployment exists.
+			if err := r.deleteOtherWorkloads(ctx, instance, namespace); err != nil {
+				errs = append(errs, err)
+			}
+			setSelectorCondition(instance, deployment, desired.Deployment)
+			// Select exactly the Deployment's pods, even if its selector
+			// predates the Webserver's current selector labels.
+			for _, service := range desired.Services {
+				service.Spec.Selector = deployment.Spec.Selector.MatchLabels
+			}
+			instance.Status.SelectorLabels = copyStringMap(deployment.Spec.Selector.MatchLabels)
+			requeueAfter, err = r.updateRolloutStatus(ctx, instance, deployment)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		if deployment != nil {
+			stableAfter = setStableCondition(instance, replicasReady(deployment), time.Now())
+		}
+	}
+	crashLooping := requeueAfter > 0
+
+	checkAfter, err := r.reconcileServices(ctx, instance, desired.Services, namespace, crashLooping)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if checkAfter > 0 {
+		requeueAfter = checkAfter
+	}
+	if stableAfter > 0 && (requeueAfter == 0 || stableAfter < requeueAfter) {
+		requeueAfter = stableAfter
+	}
+	if scaleAfter > 0 && (requeueAfter == 0 || scaleAfter < requeueAfter) {
+		requeueAfter = scaleAfter
+	}
+	if tolerationsAfter > 0 && (requeueAfter == 0 || tolerationsAfter < requeueAfter) {
+		requeueAfter = tolerationsAfter
+	}
+	if holdAfter > 0 && (requeueAfter == 0 || holdAfter < requeueAfter) {
+		requeueAfter = holdAfter
+	}
+	certificateAfter, err := r.checkCertificate(ctx, instance, namespace, time.Now())
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if certificateAfter > 0 && (requeueAfter == 0 || certificateAfter < requeueAfter) {
+		requeueAfter = certificateAfter
+	}
+
+	if err := r.reconcileExposure(ctx, instance, desired, namespace); err != nil {
+		errs = append(errs, err)
+	}
+	if err := r.reconcileAlerts(ctx, instance, desired.PrometheusRule, namespace); err != nil {
+		errs = append(errs, err)
+	}
+	for _, obj := range desired.Extra {
+		if err := r.reconcileExtraObject(ctx, instance, obj); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	instance.Status.TargetNamespace = namespace
+	pruneActions(instance, &all)
+	// Quota rejections are returned as errors, so the reconcile is retried
+	// with backoff; the condition and event say which quota to raise.
+	r.setQuotaCondition(ctx, instance, deployment, errs)
+	if observer, ok := r.Client.(*observingClient); ok {
+		observer.reportDrift(ctx, instance, status)
+	} else {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionDrifted)
+	}
+	// Set after reportDrift, which restores the status it started with, so
+	// that observing a Webserver clears the OperatorUpToDate=False an
+	// upgrade set.
+	if len(errs) == 0 {
+		setOperatorVersion(instance)
+	}
+
+	if err := r.updateStatusIfChanged(ctx, status, instance); err != nil {
+		errs = append(errs, err)
+	}
+
+	return ctrl.Result{RequeueAfter: requeueAfter}, utilerrors.NewAggregate(errs)
+}
+
+// reconcileDeployment creates or updates the Webserver's Deployment to match
+// the desired one.
+func (r *WebserverReconciler) reconcileDeployment(ctx context.Context, instance *serversv1alpha1.Webserver, desired *appsv1.Deployment) (*appsv1.Deployment, error) {
+	logger := log.FromContext(ctx)
+
+	var deployment, live *appsv1.Deployment
+	var op controllerutil.OperationResult
+	// Another writer may update the Deployment between the read and the
+	// write. Retry from a fresh read so the conflict is handled here instead
+	// of failing the whole reconcile.
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		deployment = &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      desired.Name,
+				Namespace: desired.Namespace,
 			},
-			Port: &routev1.RoutePort{
-				TargetPort: intstr.FromInt(8080),
+		}
+		op, err = r.createOrUpdate(ctx, deployment, func() error {
+			live = deployment.DeepCopy()
+			if deployment.CreationTimestamp.IsZero() {
+				deployment.Spec.Selector = desired.Spec.Selector
+			}
+			deployment.Labels = desired.Labels
+			deployment.Spec.Replicas = desired.Spec.Replicas
+			deployment.Spec.Paused = desired.Spec.Paused
+			deployment.Spec.ProgressDeadlineSeconds = desired.Spec.ProgressDeadlineSeconds
+			deployment.Spec.Strategy = desired.Spec.Strategy
+			if cause, ok := desired.Annotations[changeCauseAnnotation]; ok {
+				if deployment.Annotations == nil {
+					deployment.Annotations = map[string]string{}
+				}
+				deployment.Annotations[changeCauseAnnotation] = cause
+			} else {
+				delete(deployment.Annotations, changeCauseAnnotation)
+			}
+
+			// Once a self-heal action has been applied for this generation, leave
+			// the live pod template alone until the spec changes again.
+			if instance.Status.SelfHealedGeneration != instance.Generation {
+				template := desired.Spec.Template.DeepCopy()
+
+				// The selector is immutable, so the pods must keep the labels
+				// of the selector the Deployment was created with.
+				for k, v := range deployment.Spec.Selector.MatchLabels {
+					template.Labels[k] = v
+				}
+				if restartedAt := deployment.Spec.Template.Annotations[restartedAtAnnotation]; restartedAt != "" {
+					if template.Annotations == nil {
+						template.Annotations = map[string]string{}
+					}
+					template.Annotations[restartedAtAnnotation] = restartedAt
+				}
+				applyTemplate(deployment, &deployment.Spec.Template, template)
+			}
+
+			return r.setOwner(instance, deployment)
+		})
+		return err
+	})
+	if err != nil {
+		recordAction(ctx, instance, "Deployment", desired.Name, "", "", err)
+		return nil, err
+	}
+	recordAction(ctx, instance, "Deployment", desired.Name, live.ResourceVersion, deployment.ResourceVersion, nil)
+	logger.V(1).Info("Reconciled Deployment", "deployment", deployment.Name, "operation", op)
+	switch op {
+	case controllerutil.OperationResultUpdated:
+		deploymentUpdates.WithLabelValues("applied").Inc()
+		logger.V(2).Info("Applied Deployment changes", "deployment", deployment.Name, "diff", cmp.Diff(live.Spec, deployment.Spec))
+	case controllerutil.OperationResultNone:
+		deploymentUpdates.WithLabelValues("skipped").Inc()
+	}
+	recordApplied(&instance.Status.Resources.Deployment, live.ResourceVersion, deployment.ResourceVersion)
+	return deployment, nil
+}
+
+// applyTemplate sets the live pod template of obj, a Deployment, DaemonSet
+// or StatefulSet, unless it already matches the desired template. The API server
+// fills in defaults for fields the operator leaves empty, so the live
+// template never equals the desired one exactly, and replacing it on every
+// reconcile would send an Update each time. The live template is kept when
+// it was last written from the same desired template, recorded by hash, and
+// every field the operator sets still has its value.
+func applyTemplate(obj metav1.Object, live, template *corev1.PodTemplateSpec) {
+	hash := templateHash(template)
+	annotations := obj.GetAnnotations()
+	if annotations[templateHashAnnotation] == hash &&
+		equality.Semantic.DeepDerivative(*template, *live) {
+		return
+	}
+	*live = *template
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[templateHashAnnotation] = hash
+	obj.SetAnnotations(annotations)
+}
+
+// templateHash returns a hash of the pod template the operator wants.
+func templateHash(template *corev1.PodTemplateSpec) string {
+	data, _ := json.Marshal(template)
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// updateRolloutStatus records the state of the Deployment's rollout and its
+// pods in the Webserver's status, self-healing the rollout if requested.
+// While pods are crash looping it returns how long to back off before the
+// next reconcile, and zero otherwise.
+func (r *WebserverReconciler) updateRolloutStatus(ctx context.Context, instance *serversv1alpha1.Webserver, deployment *appsv1.Deployment) (time.Duration, error) {
+	if err := r.recordLastKnownGood(ctx, instance, deployment); err != nil {
+		return 0, err
+	}
+	if err := r.selfHeal(ctx, instance, deployment); err != nil {
+		return 0, err
+	}
+	pods, err := r.listPods(ctx, deployment.Namespace, deployment.Spec.Selector.MatchLabels)
+	if err != nil {
+		return 0, err
+	}
+	instance.Status.Summary = podSummary(pods)
+	instance.Status.Pods = podInfos(pods)
+	if imageID := runningImageID(pods); imageID != "" {
+		instance.Status.ImageID = imageID
+	}
+	instance.Status.Phase = webserverPhase(deployment, pods)
+	setDegradedCondition(instance, pods, rolloutDegraded(deployment))
+	return crashLoopRequeue(ctx, pods), nil
+}
+
+// reconcileServices applies the Webserver's Services, deletes the ones it no
+// longer lists and runs the reachability check against the route Service.
+// The check is skipped while pods are crash looping. It returns when the
+// check is next due, or zero if it did not run.
+func (r *WebserverReconciler) reconcileServices(ctx context.Context, instance *serversv1alpha1.Webserver, desired []*corev1.Service, namespace string, crashLooping bool) (time.Duration, error) {
+	var errs []error
+	var checkAfter time.Duration
+	keep := map[string]bool{}
+	// The reachability check speaks HTTP, so it skips a UDP or SCTP
+	// Service.
+	checked := ""
+	if spec := routeServiceSpec(instance); spec.Protocol == corev1.ProtocolTCP {
+		checked = spec.Name
+	}
+	var live []*corev1.Service
+	for _, svc := range desired {
+		keep[svc.Name] = true
+		service, err := r.reconcileService(ctx, instance, svc)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		live = append(live, service)
+		if service.Name == checked && !crashLooping {
+			checkAfter = r.checkReachability(ctx, instance, service, time.Now())
+		}
+	}
+	setLoadBalancerCondition(instance, live)
+	if err := r.deleteStaleServices(ctx, instance, namespace, keep); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(desired) == 0 {
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionServiceApplied)
+		meta.RemoveStatusCondition(&instance.Status.Conditions, serversv1alpha1.ConditionReachable)
+		instance.Status.LastReachabilityCheck = nil
+		instance.Status.Resources.Service = serversv1alpha1.ResourceStatus{}
+	} else {
+		setAppliedCondition(instance, serversv1alpha1.ConditionServiceApplied, utilerrors.NewAggregate(errs))
+	}
+	return checkAfter, utilerrors.NewAggregate(errs)
+}
+
+// deleteStaleServices deletes the Services the Webserver manages in
+// namespace whose names are not in keep, other than those a
+// ResourceBuilder added.
+func (r *WebserverReconciler) deleteStaleServices(ctx context.Context, instance *serversv1alpha1.Webserver, namespace string, keep map[string]bool) error {
+	if r.creating {
+		return nil
+	}
+	services := &corev1.ServiceList{}
+	err := r.Client.List(ctx, services,
+		client.InNamespace(namespace),
+		client.MatchingLabels{
+			ownerNameLabel:      instance.Name,
+			ownerNamespaceLabel: instance.Namespace,
+		})
+	if err != nil {
+		return err
+	}
+	for i := range services.Items {
+		service := &services.Items[i]
+		if keep[service.Name] || addedByBuilder(service) {
+			continue
+		}
+		log.FromContext(ctx).V(1).Info("Deleting Service no longer listed", "service", service.Name)
+		if err := r.Client.Delete(ctx, service); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// portsKeepingNodePorts returns a copy of desired in which each port that
+// does not set a NodePort keeps the one allocated to the live port of the
+// same name, so updating a Service does not move its node ports.
+func portsKeepingNodePorts(desired, live []corev1.ServicePort) []corev1.ServicePort {
+	allocated := map[string]int32{}
+	for _, port := range live {
+		allocated[port.Name] = port.NodePort
+	}
+	ports := make([]corev1.ServicePort, len(desired))
+	for i, port := range desired {
+		if port.NodePort == 0 {
+			port.NodePort = allocated[port.Name]
+		}
+		ports[i] = port
+	}
+	return ports
+}
+
+// reconcileService creates or updates one of the Webserver's Services to
+// match the desired one.
+func (r *WebserverReconciler) reconcileService(ctx context.Context, instance *serversv1alpha1.Webserver, desired *corev1.Service) (*corev1.Service, error) {
+	var service *corev1.Service
+	var liveVersion string
+	var op controllerutil.OperationResult
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() (err error) {
+		service = &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      desired.Name,
+				Namespace: desired.Namespace,
 			},
-		},
+		}
+		op, err = r.createOrUpdate(ctx, service, func() error {
+			liveVersion = service.ResourceVersion
+			if service.CreationTimestamp.IsZero() {
+				service.Spec.ClusterIP = desired.Spec.ClusterIP
+			}
+			service.Spec.Type = desired.Spec.Type
+			service.Spec.PublishNotReadyAddresses = desired.Spec.PublishNotReadyAddresses
+			service.Spec.Selector = desired.Spec.Selector
+			switch desired.Spec.Type {
+			case corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+				service.Spec.Ports = portsKeepingNodePorts(desired.Spec.Ports, service.Spec.Ports)
+			default:
+				service.Spec.Ports = desired.Spec.Ports
+			}
+			if mode, ok := desired.Annotations[topologyModeAnnotation]; ok {
+				if service.Annotations == nil {
+					service.Annotations = map[string]string{}
+				}
+				service.Annotations[topologyModeAnnotation] = mode
+			} else {
+				delete(service.Annotations, topologyModeAnnotation)
+			}
+			return r.setOwner(instance, service)
+		})
+		return err
+	})
+	recordAction(ctx, instance, "Service", desired.Name, liveVersion, service.ResourceVersion, err)
+	if err != nil {
+		return nil, err
 	}
+	log.FromContext(ctx).V(1).Info("Reconciled Service", "service", service.Name, "operation", op)
+	recordApplied(&instance.Status.Resources.Service, liveVersion, service.ResourceVersion)
+	return service, nil
+}
 
-	if err := controllerutil.SetControllerReference(instance, route, r.Scheme); err != nil {
-		return ctrl.Result{}, err
+// reconcileRoute creates the Webserver's Route if it does not exist yet,
+// updates its managed fields and ownership if those changed, and returns
+// the live Route.
+func (r *WebserverReconciler) reconcileRoute(ctx context.Context, instance *serversv1alpha1.Webserver, desired *routev1.Route) (*routev1.Route, error) {
+	logger := log.FromContext(ctx)
+
+	route := desired.DeepCopy()
+	if err := r.setOwner(instance, route); err != nil {
+		recordAction(ctx, instance, "Route", desired.Name, "", "", err)
+		return nil, err
+	}
+	err := r.Client.Create(ctx, route)
+	if err != nil && !errors.IsAlreadyExists(err) {
+		recordAction(ctx, instance, "Route", desired.Name, "", "", err)
+		return nil, err
 	}
+	logger.V(1).Info("Reconciled Route", "route", route.Name, "created", err == nil)
+	if err == nil {
+		recordAction(ctx, instance, "Route", desired.Name, "", route.ResourceVersion, nil)
+		recordApplied(&instance.Status.Resources.Route, "", route.ResourceVersion)
+		return route, nil
+	}
+	var liveVersion string
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		// Read into a fresh object: decoding into the one built for Create
+		// would keep fields, such as owner references, that the live Route
+		// lacks.
+		route = &routev1.Route{}
+		if err := r.Client.Get(ctx, client.ObjectKeyFromObject(desired), route); err != nil {
+			return err
+		}
 
-	err = r.Client.Create(context.TODO(), route)
+		live := route.DeepCopy()
+		liveVersion = live.ResourceVersion
+		applyRouteSpec(route, desired)
+		applyRouteMetadata(route, desired, instance.Spec.RouteMetadata)
+		if err := r.setOwner(instance, route); err != nil {
+			return err
+		}
+		// Every Route update makes the router reload, so only send one when
+		// a field the operator manages differs.
+		if equality.Semantic.DeepEqual(live, route) {
+			return nil
+		}
+		if err := r.Client.Update(ctx, route); err != nil {
+			return err
+		}
+		logger.V(1).Info("Updated Route", "route", route.Name, "targetPort", route.Spec.Port.TargetPort.String())
+		recordApplied(&instance.Status.Resources.Route, live.ResourceVersion, route.ResourceVersion)
+		return nil
+	})
+	recordAction(ctx, instance, "Route", desired.Name, liveVersion, route.ResourceVersion, err)
 	if err != nil {
-		return ctrl.Result{}, err
+		return nil, err
 	}
+	return route, nil
+}
+
+// applyRouteSpec sets the Route fields the operator manages, its target,
+// port, host and path, to the desired ones. An empty desired host is left
+// for the router to assign, so the host it generated is kept, and so is the
+// target weight the API server defaults. TLS is only set when the desired
+// Route sets it, which the Webserver does not, so TLS an admin configures
+// on the Route is kept. Other fields, such as the status the router
+// records, are left alone.
+func applyRouteSpec(route, desired *routev1.Route) {
+	to := desired.Spec.To
+	if to.Weight == nil {
+		to.Weight = route.Spec.To.Weight
+	}
+	route.Spec.To = to
+	route.Spec.Port = desired.Spec.Port
+	if desired.Spec.Host != "" {
+		route.Spec.Host = desired.Spec.Host
+	}
+	route.Spec.Path = desired.Spec.Path
+	if desired.Spec.TLS != nil {
+		route.Spec.TLS = desired.Spec.TLS
+	}
+}
 
-	return ctrl.Result{}, nil
+// setDefaults prepares the reconciler state shared by the controller and
+// ReconcileAll.
+func (r *WebserverReconciler) setDefaults() {
+	r.Client = newFieldOwnerClient(r.Client, r.fieldManager())
+	if r.CleanupHook == nil {
+		r.CleanupHook = NoopCleanupHook{}
+	}
+	r.checks = newNamespaceLimiter(r.MaxConcurrentChecksPerNamespace)
 }
 
-// SetupWithManager sets up the controller with the Manager.
-func (r *WebserverReconciler) SetupWithManager(mgr ctrl.Manager) error {
+// SetupWithManager sets up the controller with the Manager, registering
+// builders to run after any already in Builders.
+func (r *WebserverReconciler) SetupWithManager(mgr ctrl.Manager, builders ...ResourceBuilder) error {
+	r.Builders = append(r.Builders, builders...)
 	if err := routev1.AddToScheme(mgr.GetScheme()); err != nil {
 		os.Exit(1)
 	}
-	return ctrl.NewControllerManagedBy(mgr).
+	r.setDefaults()
+	r.cooldown = newCooldown(r.Cooldown)
+	r.holds = newRecreateHolds()
+	r.breaker = newCircuitBreaker(r.CircuitBreakerThreshold, r.CircuitBreakerCooldown)
+	r.apiReader = mgr.GetAPIReader()
+	r.secretDigests = newSecretDigests()
+
+	if err := metrics.Registry.Register(newInventoryCollector(mgr.GetClient())); err != nil {
+		return err
+	}
+	if err := mgr.Add(&outdatedMarker{client: mgr.GetClient()}); err != nil {
+		return err
+	}
+	// Only the leader migrates, and the controller reconciles nothing until
+	// it has. Observe mode changes nothing, so it has nothing to wait for.
+	if !r.ObserveOnly {
+		migration := &countMigration{client: mgr.GetClient(), done: make(chan struct{})}
+		if err := mgr.Add(migration); err != nil {
+			return err
+		}
+		r.migrated = migration.done
+	}
+
+	err := mgr.GetFieldIndexer().IndexField(context.Background(), &serversv1alpha1.Webserver{}, configMapIndex, configMapIndexValue)
+	if err != nil {
+		return err
+	}
+	err = mgr.GetFieldIndexer().IndexField(context.Background(), &serversv1alpha1.Webserver{}, secretIndex, secretIndexValue)
+	if err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
 		For(&serversv1alpha1.Webserver{}).
-		Complete(r)
+		Owns(&appsv1.Deployment{}).
+		Owns(&appsv1.DaemonSet{}).
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&networkingv1.Ingress{}).
+		Owns(&corev1.ConfigMap{}).
+		// Services are watched so that one deleted outside the operator is
+		// noticed, and its recreate delay starts, straight away.
+		Owns(&corev1.Service{}).
+		Watches(&source.Kind{Type: &appsv1.Deployment{}}, handler.EnqueueRequestsFromMapFunc(ownerFromLabels)).
+		Watches(&source.Kind{Type: &appsv1.DaemonSet{}}, handler.EnqueueRequestsFromMapFunc(ownerFromLabels)).
+		Watches(&source.Kind{Type: &appsv1.StatefulSet{}}, handler.EnqueueRequestsFromMapFunc(ownerFromLabels)).
+		Watches(&source.Kind{Type: &corev1.Service{}}, handler.EnqueueRequestsFromMapFunc(ownerFromLabels)).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.webserversForConfigMap)).
+		// Only Secret metadata is cached: the data of every Secret in the
+		// cluster would be costly to hold, and a change to it bumps the
+		// resourceVersion, which is all the watch and the Secret digests
+		// need to see. The informer cannot be narrowed to the referenced
+		// Secrets, which carry no label to select them by; the index only
+		// enqueues the Webservers that reference the changed Secret.
+		Watches(&source.Kind{Type: &corev1.Secret{}}, secretEventHandler{
+			EventHandler: handler.EnqueueRequestsFromMapFunc(r.webserversForSecret),
+			digests:      r.secretDigests,
+		}, builder.OnlyMetadata).
+		Watches(&source.Kind{Type: &corev1.Pod{}}, handler.EnqueueRequestsFromMapFunc(r.webserverForPod)).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             newRateLimiter(r.Cooldown),
+		})
+
+	// Namespaces are only watched, and cached, with sidecar injection on.
+	if r.SidecarTemplates.Name != "" {
+		b = b.
+			Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.webserversForSidecarTemplates)).
+			Watches(&source.Kind{Type: &corev1.Namespace{}}, handler.EnqueueRequestsFromMapFunc(r.webserversForNamespace))
+	}
+
+	// Routes are only watched on clusters that serve them, such as
+	// OpenShift.
+	if available, err := r.routeAvailable(); err != nil {
+		return err
+	} else if available {
+		b = b.
+			Owns(&routev1.Route{}).
+			Watches(&source.Kind{Type: &routev1.Route{}}, handler.EnqueueRequestsFromMapFunc(ownerFromLabels))
+	}
+	// HTTPRoutes are only watched when the Gateway API is installed at
+	// startup; the operator still manages them if it is installed later.
+	if available, err := r.httpRouteAvailable(); err != nil {
+		return err
+	} else if available {
+		httpRoute := &unstructured.Unstructured{}
+		httpRoute.SetGroupVersionKind(httpRouteGVK)
+		b = b.Owns(httpRoute)
+	}
+	// Likewise for PrometheusRules and the Prometheus Operator.
+	if available, err := r.prometheusRuleAvailable(); err != nil {
+		return err
+	} else if available {
+		rule := &unstructured.Unstructured{}
+		rule.SetGroupVersionKind(prometheusRuleGVK)
+		b = b.Owns(rule)
+	}
+	return b.Complete(r)
 }
@@ -17,22 +17,45 @@ limitations under the License.
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"strings"
+	"time"
+
+	// Embed the IANA time zone database: the distroless manager image has
+	// none, and spec.scaleSchedule.timeZone may name any zone.
+	_ "time/tzdata"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	routev1 "github.com/openshift/api/route/v1"
+	"go.uber.org/zap/zapcore"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"k8s.io/client-go/discovery"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/yaml"
 
 	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
 	"github.com/jacobsee/sample-operator/controllers"
+	"github.com/jacobsee/sample-operator/pkg/metricsserver"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -43,31 +66,239 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(routev1.AddToScheme(scheme))
 
 	utilruntime.Must(serversv1alpha1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "render" {
+		if err := render(os.Args[2:], os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var enableSelfHeal bool
+	var maxRollbackAttempts int
+	var verbosity int
+	var reconcileCooldown time.Duration
+	var recreateDelay time.Duration
+	var fieldManager string
+	var maxConcurrentReconciles int
+	var maxConcurrentChecks int
+	var defaultImage string
+	var requiredLabels string
+	var allowedServiceTypes string
+	var registryMirrors string
+	var rollOutDefaultImage bool
+	var breakerThreshold int
+	var breakerCooldown time.Duration
+	var sizeProfilesConfigMap string
+	var runOnce bool
+	var observeOnly bool
+	var sidecarTemplates string
+	var metricsSecure bool
+	var metricsCertDir string
+	var metricsAuthorize bool
+	var enableAdminEndpoint bool
+	var crdWaitTimeout time.Duration
+	var finalizer string
+	var finalizeAfter string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
+	flag.BoolVar(&metricsSecure, "metrics-secure", false,
+		"Serve the metrics endpoint over HTTPS, with the certificate and key in --metrics-cert-dir.")
+	flag.StringVar(&metricsCertDir, "metrics-cert-dir", "/tmp/k8s-metrics-server/serving-certs",
+		"Directory holding tls.crt and tls.key for --metrics-secure.")
+	flag.BoolVar(&metricsAuthorize, "metrics-authorize", false,
+		"With --metrics-secure, only serve metrics to callers whose bearer token is allowed to get /metrics.")
+	flag.BoolVar(&enableAdminEndpoint, "enable-admin-endpoint", false,
+		"Serve a read-only JSON list of the Webservers at "+controllers.WebserverListPath+" on the metrics endpoint, "+
+			"protected like /metrics.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	flag.DurationVar(&crdWaitTimeout, "crd-wait-timeout", 2*time.Minute,
+		"How long to wait at startup for the Webserver CRD to be established before exiting.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&enableSelfHeal, "enable-self-heal", false,
+		"Allow Webservers with a selfHeal policy to have rollouts that exceed their "+
+			"progress deadline restarted or rolled back.")
+	flag.IntVar(&maxRollbackAttempts, "max-rollback-attempts", 3,
+		"How many times a Webserver with selfHeal Rollback is rolled back before a rollout of its own "+
+			"pod template completes. Zero means no limit.")
+	flag.DurationVar(&reconcileCooldown, "reconcile-cooldown", 0,
+		"Minimum interval between reconciles of the same Webserver. Zero disables the cooldown.")
+	flag.DurationVar(&recreateDelay, "recreate-delay", 0,
+		"How long Services, Routes and Ingresses deleted outside the operator stay deleted before they are "+
+			"recreated. Webservers can override it with the servers.redhat.com/recreate-delay annotation. "+
+			"Zero recreates them straight away.")
+	flag.StringVar(&fieldManager, "field-manager", controllers.DefaultFieldManager,
+		"Field manager name for the operator's writes, also used as the app.kubernetes.io/managed-by label value.")
+	flag.StringVar(&finalizer, "finalizer-name", controllers.DefaultFinalizer,
+		"Name of the finalizer that holds deleted Webservers until the operator has cleaned up after them.")
+	flag.StringVar(&finalizeAfter, "finalize-after", "",
+		"Comma-separated finalizers of other controllers that must be removed from a deleted Webserver "+
+			"before the operator cleans up and removes its own.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"Number of Webservers reconciled in parallel.")
+	flag.IntVar(&maxConcurrentChecks, "max-concurrent-checks-per-namespace", 0,
+		"Maximum reachability checks running at once for Webservers in one namespace. Zero means no limit.")
+	flag.StringVar(&defaultImage, "default-image", envOrDefault("DEFAULT_WEBSERVER_IMAGE", controllers.DefaultImage),
+		"Image used for Webservers that do not set spec.image. Defaults to $DEFAULT_WEBSERVER_IMAGE when set.")
+	flag.BoolVar(&rollOutDefaultImage, "roll-out-default-image", false,
+		"Roll Webservers that do not set spec.image out to a changed --default-image on startup. "+
+			"Otherwise each picks up the new default the next time its spec changes.")
+	flag.StringVar(&registryMirrors, "registry-mirrors", "",
+		"Comma-separated source=mirror image prefixes, e.g. registry.redhat.io=mirror.corp/registry.redhat.io. "+
+			"Webserver images under a source prefix are pulled from the mirror instead.")
+	flag.StringVar(&requiredLabels, "required-labels", "",
+		"Comma-separated label keys the validating webhook requires on every Webserver.")
+	flag.StringVar(&allowedServiceTypes, "allowed-service-types", "",
+		"Comma-separated Service types (ClusterIP, NodePort, LoadBalancer) Webservers may use, "+
+			"e.g. ClusterIP,NodePort on clusters without a load balancer. Empty allows all types.")
+	flag.IntVar(&breakerThreshold, "circuit-breaker-threshold", 0,
+		"Consecutive reconciles failing with API server errors before all reconciles are held off. Zero disables the circuit breaker.")
+	flag.DurationVar(&breakerCooldown, "circuit-breaker-cooldown", 30*time.Second,
+		"How long reconciles are held off once the circuit breaker opens.")
+	flag.StringVar(&sizeProfilesConfigMap, "size-profiles-configmap", "",
+		"namespace/name of a ConfigMap, read at startup, that overrides the resources of the small, medium and large size profiles.")
+	flag.StringVar(&sidecarTemplates, "sidecar-templates-configmap", "",
+		"namespace/name of a ConfigMap of sidecar container lists. Webserver pods in namespaces labelled "+
+			"servers.redhat.com/sidecar-injection get the containers of the entry the label names.")
+	flag.BoolVar(&observeOnly, "observe-only", false,
+		"Report drift of owned objects in each Webserver's Drifted condition instead of correcting it. Writes are sent as dry runs.")
+	flag.BoolVar(&runOnce, "run-once", false,
+		"Reconcile every Webserver once, then exit. Exits nonzero if any reconcile failed.")
+	flag.IntVar(&verbosity, "v", 0,
+		"Log verbosity. 1 logs each object the reconciler creates or updates, 2 also logs the changes applied. "+
+			"Overrides --zap-log-level when set.")
 	opts := zap.Options{
 		Development: true,
 	}
 	opts.BindFlags(flag.CommandLine)
 	flag.Parse()
 
+	controllers.DefaultImage = defaultImage
+	mirrors, err := controllers.ParseRegistryMirrors(registryMirrors)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	controllers.RegistryMirrors = mirrors
+	for _, key := range strings.Split(requiredLabels, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			serversv1alpha1.RequiredLabels = append(serversv1alpha1.RequiredLabels, key)
+		}
+	}
+	for _, t := range strings.Split(allowedServiceTypes, ",") {
+		switch t := corev1.ServiceType(strings.TrimSpace(t)); t {
+		case "":
+		case corev1.ServiceTypeClusterIP, corev1.ServiceTypeNodePort, corev1.ServiceTypeLoadBalancer:
+			serversv1alpha1.AllowedServiceTypes = append(serversv1alpha1.AllowedServiceTypes, t)
+		default:
+			fmt.Fprintf(os.Stderr, "invalid --allowed-service-types: unsupported Service type %q\n", t)
+			os.Exit(1)
+		}
+	}
+
+	levelSet := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "zap-log-level" {
+			levelSet = true
+		}
+	})
+	switch {
+	case verbosity > 0:
+		opts.Level = zapcore.Level(-verbosity)
+	case !levelSet:
+		// Development mode defaults to the debug level, which would log
+		// V(1) messages without --v.
+		opts.Level = zapcore.InfoLevel
+	}
+
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	sidecarTemplatesKey, err := parseNamespacedName(sidecarTemplates)
+	if err != nil {
+		setupLog.Error(err, "invalid --sidecar-templates-configmap")
+		os.Exit(1)
+	}
+	if msgs := validation.IsQualifiedName(finalizer); len(msgs) > 0 || !strings.Contains(finalizer, "/") {
+		setupLog.Error(fmt.Errorf("%q must be a domain-qualified name such as example.com/finalizer", finalizer), "invalid --finalizer-name")
+		os.Exit(1)
+	}
+	var finalizeAfterNames []string
+	for _, name := range strings.Split(finalizeAfter, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			finalizeAfterNames = append(finalizeAfterNames, name)
+		}
+	}
+
+	reconciler := &controllers.WebserverReconciler{
+		Scheme:                          scheme,
+		EnableSelfHeal:                  enableSelfHeal,
+		MaxRollbackAttempts:             int32(maxRollbackAttempts),
+		Cooldown:                        reconcileCooldown,
+		RecreateDelay:                   recreateDelay,
+		FieldManager:                    fieldManager,
+		Finalizer:                       finalizer,
+		FinalizeAfter:                   finalizeAfterNames,
+		MaxConcurrentReconciles:         maxConcurrentReconciles,
+		MaxConcurrentChecksPerNamespace: maxConcurrentChecks,
+		RollOutDefaultImage:             rollOutDefaultImage,
+		ObserveOnly:                     observeOnly,
+		SidecarTemplates:                sidecarTemplatesKey,
+		CircuitBreakerThreshold:         breakerThreshold,
+		CircuitBreakerCooldown:          breakerCooldown,
+	}
+
+	ctx := ctrl.SetupSignalHandler()
+	cfg := ctrl.GetConfigOrDie()
+
+	if runOnce {
+		c, err := client.New(cfg, client.Options{Scheme: scheme})
+		if err != nil {
+			setupLog.Error(err, "unable to create client")
+			os.Exit(1)
+		}
+		if err := loadSizeProfiles(c, sizeProfilesConfigMap); err != nil {
+			setupLog.Error(err, "unable to load size profiles")
+			os.Exit(1)
+		}
+		if !observeOnly {
+			if _, err := controllers.MigrateUnsetCount(ctx, c); err != nil {
+				setupLog.Error(err, "unable to migrate Webservers scaled to zero")
+				os.Exit(1)
+			}
+		}
+		reconciler.Client = c
+		if err := reconciler.ReconcileAll(ctx); err != nil {
+			setupLog.Error(err, "reconciling Webservers failed")
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := waitForCRDs(ctx, cfg, probeAddr, crdWaitTimeout); err != nil {
+		setupLog.Error(err, "unable to start manager")
+		os.Exit(1)
+	}
+
+	// With --metrics-secure the manager's plaintext endpoint is disabled and
+	// metricsserver serves the same registry instead.
+	managerMetricsAddr := metricsAddr
+	if metricsSecure {
+		managerMetricsAddr = "0"
+	}
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{
 		Scheme:                 scheme,
-		MetricsBindAddress:     metricsAddr,
+		MetricsBindAddress:     managerMetricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
@@ -78,13 +309,51 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err = (&controllers.WebserverReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
-	}).SetupWithManager(mgr); err != nil {
+	adminHandlers := map[string]http.Handler{}
+	if enableAdminEndpoint {
+		adminHandlers[controllers.WebserverListPath] = controllers.NewWebserverListHandler(mgr.GetClient())
+	}
+	if metricsSecure {
+		server, err := metricsserver.New(metricsserver.Options{
+			BindAddress:   metricsAddr,
+			CertDir:       metricsCertDir,
+			Authorize:     metricsAuthorize,
+			Config:        mgr.GetConfig(),
+			ExtraHandlers: adminHandlers,
+		})
+		if err == nil {
+			err = mgr.Add(server)
+		}
+		if err != nil {
+			setupLog.Error(err, "unable to set up secure metrics server")
+			os.Exit(1)
+		}
+	} else {
+		for path, handler := range adminHandlers {
+			if err := mgr.AddMetricsExtraHandler(path, handler); err != nil {
+				setupLog.Error(err, "unable to set up admin endpoint", "path", path)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if err := loadSizeProfiles(mgr.GetAPIReader(), sizeProfilesConfigMap); err != nil {
+		setupLog.Error(err, "unable to load size profiles")
+		os.Exit(1)
+	}
+
+	reconciler.Client = mgr.GetClient()
+	reconciler.Recorder = mgr.GetEventRecorderFor("webserver-controller")
+	if err = reconciler.SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Webserver")
 		os.Exit(1)
 	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&serversv1alpha1.Webserver{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "Webserver")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -96,9 +365,145 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("starting manager")
-	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+	setupLog.Info("starting manager", "version", controllers.OperatorVersion)
+	if err := mgr.Start(ctx); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// waitForCRDs blocks until the CRDs the controller watches are established,
+// giving up after timeout. The manager's probe server only starts with the
+// manager, so while waiting the probes are served on probeAddr here, with
+// readyz failing until the CRDs are found.
+func waitForCRDs(ctx context.Context, cfg *rest.Config, probeAddr string, timeout time.Duration) error {
+	d, err := discovery.NewDiscoveryClientForConfig(cfg)
+	if err != nil {
+		return err
+	}
+	waiter := controllers.NewCRDWaiter(d)
+
+	if probeAddr != "0" {
+		mux := http.NewServeMux()
+		healthzHandler := &healthz.Handler{Checks: map[string]healthz.Checker{"healthz": healthz.Ping}}
+		readyzHandler := &healthz.Handler{Checks: map[string]healthz.Checker{"crds": waiter.Check}}
+		mux.Handle("/healthz", http.StripPrefix("/healthz", healthzHandler))
+		mux.Handle("/healthz/", http.StripPrefix("/healthz", healthzHandler))
+		mux.Handle("/readyz", http.StripPrefix("/readyz", readyzHandler))
+		mux.Handle("/readyz/", http.StripPrefix("/readyz", readyzHandler))
+		server := &http.Server{Addr: probeAddr, Handler: mux}
+		served := make(chan struct{})
+		go func() {
+			defer close(served)
+			if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				setupLog.Error(err, "serving probes while waiting for CRDs")
+			}
+		}()
+		// The manager binds the same address next, so the listener must be
+		// closed, and the server stopped, before this returns.
+		defer func() {
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := server.Shutdown(shutdownCtx); err != nil {
+				setupLog.Error(err, "stopping the probe server used while waiting for CRDs")
+			}
+			<-served
+		}()
+	}
+
+	return waiter.Wait(ctx, timeout)
+}
+
+// envOrDefault returns the value of the environment variable key, or def when
+// it is unset or empty.
+func envOrDefault(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// loadSizeProfiles overrides the size profiles from the ConfigMap named by
+// value, as namespace/name. An empty value keeps the built-in profiles.
+func loadSizeProfiles(reader client.Reader, value string) error {
+	if value == "" {
+		return nil
+	}
+	key, err := parseNamespacedName(value)
+	if err != nil {
+		return fmt.Errorf("--size-profiles-configmap: %w", err)
+	}
+	return controllers.LoadSizeProfiles(context.Background(), reader, key)
+}
+
+// parseNamespacedName parses a namespace/name flag value. An empty value
+// yields an empty name.
+func parseNamespacedName(value string) (types.NamespacedName, error) {
+	key := types.NamespacedName{}
+	if value == "" {
+		return key, nil
+	}
+	if parts := strings.SplitN(value, "/", 2); len(parts) == 2 {
+		key.Namespace, key.Name = parts[0], parts[1]
+	}
+	if key.Namespace == "" || key.Name == "" {
+		return key, fmt.Errorf("must be namespace/name, got %q", value)
+	}
+	return key, nil
+}
+
+// render prints the objects the operator would create for each Webserver in
+// the given manifest, as a multi-document YAML stream.
+func render(args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	file := fs.String("f", "-", "Webserver manifest to render, or - to read from stdin.")
+	fs.StringVar(&controllers.DefaultImage, "default-image", envOrDefault("DEFAULT_WEBSERVER_IMAGE", controllers.DefaultImage),
+		"Image used for Webservers that do not set spec.image. Defaults to $DEFAULT_WEBSERVER_IMAGE when set.")
+	mirrors := fs.String("registry-mirrors", "", "Comma-separated source=mirror image prefixes to pull from instead.")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	var err error
+	if controllers.RegistryMirrors, err = controllers.ParseRegistryMirrors(*mirrors); err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	decoder := utilyaml.NewYAMLOrJSONDecoder(in, 4096)
+	for {
+		instance := &serversv1alpha1.Webserver{}
+		if err := decoder.Decode(instance); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		objs, err := controllers.RenderManifests(instance)
+		if err != nil {
+			return fmt.Errorf("rendering Webserver %q: %w", instance.Name, err)
+		}
+		for _, obj := range objs {
+			gvk, err := apiutil.GVKForObject(obj, scheme)
+			if err != nil {
+				return err
+			}
+			obj.GetObjectKind().SetGroupVersionKind(gvk)
+
+			data, err := yaml.Marshal(obj)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "---\n%s", data)
+		}
+	}
+}
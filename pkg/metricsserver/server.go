@@ -0,0 +1,221 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metricsserver serves the controller-runtime metrics registry over
+// HTTPS, optionally requiring callers to be authorized for the /metrics
+// path the way kube-rbac-proxy does.
+package metricsserver
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var log = logf.Log.WithName("metrics-server")
+
+// Options configures the metrics server.
+type Options struct {
+	// BindAddress is the address the server listens on, such as ":8443".
+	BindAddress string
+
+	// CertDir holds the serving certificate and key as tls.crt and
+	// tls.key. They are reloaded when the files change.
+	CertDir string
+
+	// Authorize requires each request to carry a bearer token whose user
+	// may get the requested path, checked with a TokenReview and a
+	// SubjectAccessReview. The manager's ServiceAccount then needs create
+	// on both.
+	Authorize bool
+
+	// Config is used to create the reviews when Authorize is set.
+	Config *rest.Config
+
+	// ExtraHandlers are served next to /metrics, keyed by path, and
+	// authorized the same way.
+	ExtraHandlers map[string]http.Handler
+}
+
+// Server serves /metrics over HTTPS. It implements manager.Runnable.
+type Server struct {
+	opts   Options
+	client kubernetes.Interface
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// New returns a Server for opts. Add it to the manager with mgr.Add and
+// disable the manager's own metrics endpoint.
+func New(opts Options) (*Server, error) {
+	s := &Server{opts: opts}
+	if opts.Authorize {
+		client, err := kubernetes.NewForConfig(opts.Config)
+		if err != nil {
+			return nil, err
+		}
+		s.client = client
+	}
+	if _, err := s.certificate(nil); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NeedLeaderElection implements manager.LeaderElectionRunnable, so every
+// replica serves its metrics.
+func (s *Server) NeedLeaderElection() bool {
+	return false
+}
+
+// Start serves metrics until ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.opts.BindAddress)
+	if err != nil {
+		return err
+	}
+	log.Info("Serving metrics over HTTPS", "address", listener.Addr().String(), "authorize", s.opts.Authorize)
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.authorize(promhttp.HandlerFor(metrics.Registry, promhttp.HandlerOpts{})))
+	for path, handler := range s.opts.ExtraHandlers {
+		mux.Handle(path, s.authorize(handler))
+	}
+	server := &http.Server{
+		Handler: mux,
+		TLSConfig: &tls.Config{
+			MinVersion:     tls.VersionTLS12,
+			GetCertificate: s.certificate,
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Error(err, "Shutting down metrics server")
+		}
+	}()
+
+	if err := server.ServeTLS(listener, "", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// certificate returns the serving certificate, reloading it from CertDir
+// when tls.crt has changed since it was last read.
+func (s *Server) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	certFile := filepath.Join(s.opts.CertDir, "tls.crt")
+	info, err := os.Stat(certFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cert != nil && info.ModTime().Equal(s.modTime) {
+		return s.cert, nil
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, filepath.Join(s.opts.CertDir, "tls.key"))
+	if err != nil {
+		return nil, err
+	}
+	s.cert, s.modTime = &cert, info.ModTime()
+	return s.cert, nil
+}
+
+// authorize wraps next so that, with Authorize set, only callers allowed to
+// get the request path reach it.
+func (s *Server) authorize(next http.Handler) http.Handler {
+	if !s.opts.Authorize {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := s.review(r)
+		if err != nil {
+			log.V(1).Info("Rejected request", "remote", r.RemoteAddr, "reason", err.Error())
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// review authenticates the request's bearer token and checks that its user
+// may perform the request on its non-resource path. It returns the HTTP
+// status to answer with when the request is not allowed.
+func (s *Server) review(r *http.Request) (int, error) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if token == "" || token == r.Header.Get("Authorization") {
+		return http.StatusUnauthorized, errors.New("no bearer token")
+	}
+
+	ctx := r.Context()
+	tokenReview, err := s.client.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{Token: token},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !tokenReview.Status.Authenticated {
+		return http.StatusUnauthorized, fmt.Errorf("token not authenticated: %s", tokenReview.Status.Error)
+	}
+
+	user := tokenReview.Status.User
+	extra := map[string]authorizationv1.ExtraValue{}
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	review, err := s.client.AuthorizationV1().SubjectAccessReviews().Create(ctx, &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			User:   user.Username,
+			Groups: user.Groups,
+			UID:    user.UID,
+			Extra:  extra,
+			NonResourceAttributes: &authorizationv1.NonResourceAttributes{
+				Path: r.URL.Path,
+				Verb: strings.ToLower(r.Method),
+			},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	if !review.Status.Allowed {
+		return http.StatusForbidden, fmt.Errorf("%s may not %s %s: %s", user.Username, strings.ToLower(r.Method), r.URL.Path, review.Status.Reason)
+	}
+	return 0, nil
+}
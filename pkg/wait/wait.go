@@ -0,0 +1,97 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package wait lets tests and tooling block until a Webserver is ready,
+// using the same status the operator reports.
+package wait
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+// PollInterval is how often WaitForReady reads the Webserver.
+var PollInterval = time.Second
+
+// WaitForReady polls the Webserver until it is ready, or fails once timeout
+// has passed or ctx is done. The error then says why the Webserver was not
+// ready when last read.
+//
+// A Webserver is ready when the operator has applied its current generation,
+// its phase is Ready and it is not Degraded.
+func WaitForReady(ctx context.Context, c client.Client, key types.NamespacedName, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	reason := "not read yet"
+	err := wait.PollImmediateUntil(PollInterval, func() (bool, error) {
+		instance := &serversv1alpha1.Webserver{}
+		if err := c.Get(ctx, key, instance); err != nil {
+			if ctx.Err() != nil {
+				return false, nil
+			}
+			return false, err
+		}
+		var ready bool
+		ready, reason = Ready(instance)
+		return ready, nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("Webserver %s is not ready: %s", key, reason)
+	}
+	return err
+}
+
+// Ready reports whether the Webserver is ready and, if not, why.
+func Ready(instance *serversv1alpha1.Webserver) (bool, string) {
+	kind, conditionType := workload(instance)
+	applied := meta.FindStatusCondition(instance.Status.Conditions, conditionType)
+	switch {
+	case applied == nil || applied.ObservedGeneration != instance.Generation:
+		return false, fmt.Sprintf("generation %d has not been reconciled", instance.Generation)
+	case applied.Status != metav1.ConditionTrue:
+		return false, fmt.Sprintf("%s not applied: %s", kind, applied.Message)
+	}
+	if degraded := meta.FindStatusCondition(instance.Status.Conditions, serversv1alpha1.ConditionDegraded); degraded != nil && degraded.Status == metav1.ConditionTrue {
+		return false, fmt.Sprintf("degraded: %s", degraded.Message)
+	}
+	if instance.Status.Phase != serversv1alpha1.PhaseReady {
+		return false, fmt.Sprintf("phase is %q", instance.Status.Phase)
+	}
+	return true, ""
+}
+
+// workload returns the kind of the workload running the Webserver's pods and
+// the condition reporting whether it was applied.
+func workload(instance *serversv1alpha1.Webserver) (string, string) {
+	switch instance.Spec.WorkloadType {
+	case serversv1alpha1.WorkloadDaemonSet:
+		return "DaemonSet", serversv1alpha1.ConditionDaemonSetApplied
+	case serversv1alpha1.WorkloadStatefulSet:
+		return "StatefulSet", serversv1alpha1.ConditionStatefulSetApplied
+	default:
+		return "Deployment", serversv1alpha1.ConditionDeploymentApplied
+	}
+}
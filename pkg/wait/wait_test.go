@@ -0,0 +1,52 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package wait
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	serversv1alpha1 "github.com/jacobsee/sample-operator/api/v1alpha1"
+)
+
+func TestReadyChecksTheWorkloadKind(t *testing.T) {
+	for _, tc := range []struct {
+		workloadType serversv1alpha1.WorkloadType
+		applied      string
+	}{
+		{"", serversv1alpha1.ConditionDeploymentApplied},
+		{serversv1alpha1.WorkloadDeployment, serversv1alpha1.ConditionDeploymentApplied},
+		{serversv1alpha1.WorkloadDaemonSet, serversv1alpha1.ConditionDaemonSetApplied},
+		{serversv1alpha1.WorkloadStatefulSet, serversv1alpha1.ConditionStatefulSetApplied},
+	} {
+		instance := &serversv1alpha1.Webserver{ObjectMeta: metav1.ObjectMeta{Generation: 3}}
+		instance.Spec.WorkloadType = tc.workloadType
+		instance.Status.Phase = serversv1alpha1.PhaseReady
+		if ready, _ := Ready(instance); ready {
+			t.Errorf("%q: ready without an applied condition", tc.workloadType)
+		}
+		instance.Status.Conditions = []metav1.Condition{{
+			Type:               tc.applied,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: 3,
+		}}
+		if ready, reason := Ready(instance); !ready {
+			t.Errorf("%q: not ready with %s: %s", tc.workloadType, tc.applied, reason)
+		}
+	}
+}